@@ -0,0 +1,216 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+)
+
+type Client struct {
+	CID  uint32
+	Port uint32
+}
+
+func NewClient(cid, port uint32) *Client {
+	if port == 0 {
+		port = DefaultPort
+	}
+
+	return &Client{CID: cid, Port: port}
+}
+
+func (client *Client) dial(ctx context.Context) (*os.File, func(), error) {
+	conn, err := Dial(client.CID, client.Port)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+
+	return conn, func() {
+		stop()
+		conn.Close()
+	}, nil
+}
+
+func (client *Client) Do(ctx context.Context, request *Request) (*Response, error) {
+	conn, closer, err := client.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closer()
+
+	if err = json.NewEncoder(conn).Encode(request); err != nil {
+		return nil, err
+	}
+
+	response := &Response{}
+
+	if err = json.NewDecoder(conn).Decode(response); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, err
+	}
+
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+
+	return response, nil
+}
+
+func (client *Client) Exec(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, command ...string) (int, error) {
+	conn, closer, err := client.dial(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	defer closer()
+
+	return stream(ctx, conn, stdin, stdout, stderr, command)
+}
+
+func stream(ctx context.Context, conn io.ReadWriter, stdin io.Reader, stdout, stderr io.Writer, command []string) (int, error) {
+	encoder := json.NewEncoder(conn)
+
+	if err := encoder.Encode(&Request{Type: RequestExec, Command: command}); err != nil {
+		return 0, err
+	}
+
+	go func() {
+		if stdin == nil {
+			_ = encoder.Encode(&Frame{Stream: StreamStdin, Close: true})
+			return
+		}
+
+		data := make([]byte, 32*1024)
+
+		for {
+			n, err := stdin.Read(data)
+			if n > 0 {
+				if encoder.Encode(&Frame{Stream: StreamStdin, Data: data[:n]}) != nil {
+					return
+				}
+			}
+
+			if err != nil {
+				_ = encoder.Encode(&Frame{Stream: StreamStdin, Close: true})
+				return
+			}
+		}
+	}()
+
+	decoder := json.NewDecoder(conn)
+
+	for {
+		frame := &Frame{}
+
+		if err := decoder.Decode(frame); err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+
+			return 0, err
+		}
+
+		var writer io.Writer
+
+		switch frame.Stream {
+		case StreamStdout:
+			writer = stdout
+		case StreamStderr:
+			writer = stderr
+		case StreamExit:
+			if frame.Error != "" {
+				return frame.Code, errors.New(frame.Error)
+			}
+
+			return frame.Code, nil
+		}
+
+		if writer != nil {
+			if _, err := writer.Write(frame.Data); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+func (client *Client) ReadFile(ctx context.Context, name string) ([]byte, error) {
+	response, err := client.Do(ctx, &Request{Type: RequestRead, Path: name})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Data, nil
+}
+
+func (client *Client) WriteFile(ctx context.Context, name string, data []byte, mode os.FileMode) error {
+	_, err := client.Do(ctx, &Request{Type: RequestWrite, Path: name, Data: data, Mode: uint32(mode.Perm())})
+	return err
+}
+
+func (client *Client) CopyIn(ctx context.Context, local, remote string) error {
+	stat, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(local)
+	if err != nil {
+		return err
+	}
+
+	return client.WriteFile(ctx, remote, data, stat.Mode())
+}
+
+func (client *Client) CopyOut(ctx context.Context, remote, local string) error {
+	data, err := client.ReadFile(ctx, remote)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(local, data, 0644)
+}
+
+func (client *Client) Logs(ctx context.Context) ([]byte, error) {
+	response, err := client.Do(ctx, &Request{Type: RequestLogs})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Data, nil
+}
@@ -0,0 +1,68 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package agent
+
+const DefaultPort = 1024
+
+type RequestType int
+
+const (
+	RequestExec RequestType = iota
+	RequestRead
+	RequestWrite
+	RequestLogs
+)
+
+type Request struct {
+	Type        RequestType `json:"type"`
+	Command     []string    `json:"command,omitempty"`
+	Environment []string    `json:"environment,omitempty"`
+	Dir         string      `json:"dir,omitempty"`
+	Path        string      `json:"path,omitempty"`
+	Mode        uint32      `json:"mode,omitempty"`
+	Data        []byte      `json:"data,omitempty"`
+}
+
+type Response struct {
+	Stdout []byte `json:"stdout,omitempty"`
+	Stderr []byte `json:"stderr,omitempty"`
+	Code   int    `json:"code"`
+	Data   []byte `json:"data,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Stream int
+
+const (
+	StreamStdin Stream = iota
+	StreamStdout
+	StreamStderr
+	StreamExit
+)
+
+// Frame carries exec input and output after the request, closing stdin and
+// reporting the exit code end the stream.
+type Frame struct {
+	Stream Stream `json:"stream"`
+	Data   []byte `json:"data,omitempty"`
+	Close  bool   `json:"close,omitempty"`
+	Code   int    `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,201 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"golang.org/x/sys/unix"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+)
+
+func ListenAndServe(ctx context.Context, port uint32) error {
+	listener, err := Listen(port)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		go serve(ctx, conn)
+	}
+}
+
+func serve(ctx context.Context, conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	request := &Request{}
+
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+
+	if err := decoder.Decode(request); err != nil {
+		_ = encoder.Encode(&Response{Error: err.Error()})
+		return
+	}
+
+	if request.Type == RequestExec {
+		execute(ctx, decoder, encoder, request)
+		return
+	}
+
+	response, err := handle(ctx, request)
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	_ = encoder.Encode(response)
+}
+
+type frameWriter struct {
+	stream Stream
+	send   func(*Frame) error
+}
+
+func (writer *frameWriter) Write(data []byte) (int, error) {
+	if err := writer.send(&Frame{Stream: writer.stream, Data: data}); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func execute(ctx context.Context, decoder *json.Decoder, encoder *json.Encoder, request *Request) {
+	var m sync.Mutex
+
+	send := func(frame *Frame) error {
+		defer m.Unlock()
+		m.Lock()
+
+		return encoder.Encode(frame)
+	}
+
+	if len(request.Command) == 0 {
+		_ = send(&Frame{Stream: StreamExit, Error: "missing command"})
+		return
+	}
+
+	cmd := exec.CommandContext(ctx, request.Command[0], request.Command[1:]...)
+	cmd.Env = append(os.Environ(), request.Environment...)
+	cmd.Dir = request.Dir
+	cmd.Stdout = &frameWriter{stream: StreamStdout, send: send}
+	cmd.Stderr = &frameWriter{stream: StreamStderr, send: send}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		_ = send(&Frame{Stream: StreamExit, Error: err.Error()})
+		return
+	}
+
+	if err = cmd.Start(); err != nil {
+		_ = send(&Frame{Stream: StreamExit, Error: err.Error()})
+		return
+	}
+
+	go func() {
+		defer stdin.Close()
+
+		for {
+			frame := &Frame{}
+
+			if err := decoder.Decode(frame); err != nil || frame.Close {
+				return
+			}
+
+			if _, err := stdin.Write(frame.Data); err != nil {
+				return
+			}
+		}
+	}()
+
+	frame := &Frame{Stream: StreamExit}
+
+	var exitError *exec.ExitError
+
+	if err = cmd.Wait(); errors.As(err, &exitError) {
+		frame.Code = exitError.ExitCode()
+	} else if err != nil {
+		frame.Error = err.Error()
+	}
+
+	_ = send(frame)
+}
+
+func handle(ctx context.Context, request *Request) (*Response, error) {
+	response := &Response{}
+
+	switch request.Type {
+	case RequestRead:
+		data, err := os.ReadFile(request.Path)
+		if err != nil {
+			return response, err
+		}
+
+		response.Data = data
+		return response, nil
+	case RequestWrite:
+		mode := fs.FileMode(request.Mode)
+		if mode == 0 {
+			mode = 0644
+		}
+
+		if err := os.MkdirAll(path.Dir(request.Path), 0755); err != nil {
+			return response, err
+		}
+
+		return response, os.WriteFile(request.Path, request.Data, mode)
+	case RequestLogs:
+		size, err := unix.Klogctl(unix.SYSLOG_ACTION_SIZE_BUFFER, nil)
+		if err != nil {
+			return response, err
+		}
+
+		data := make([]byte, size)
+
+		n, err := unix.Klogctl(unix.SYSLOG_ACTION_READ_ALL, data)
+		if err != nil {
+			return response, err
+		}
+
+		response.Data = data[:n]
+		return response, nil
+	default:
+		return response, errors.New("invalid request type")
+	}
+}
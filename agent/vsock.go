@@ -0,0 +1,100 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package agent
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+	"strconv"
+)
+
+type Listener struct {
+	file *os.File
+}
+
+func Listen(port uint32) (*Listener, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = unix.Bind(fd, &unix.SockaddrVM{CID: unix.VMADDR_CID_ANY, Port: port}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	if err = unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &Listener{file: os.NewFile(uintptr(fd), "vsock:"+strconv.FormatUint(uint64(port), 10))}, nil
+}
+
+func (listener *Listener) Accept() (io.ReadWriteCloser, error) {
+	raw, err := listener.file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		fd        int
+		acceptErr error
+	)
+
+	err = raw.Read(func(s uintptr) bool {
+		fd, _, acceptErr = unix.Accept4(int(s), unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK)
+		return !errors.Is(acceptErr, unix.EAGAIN)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if acceptErr != nil {
+		return nil, acceptErr
+	}
+
+	return os.NewFile(uintptr(fd), "vsock"), nil
+}
+
+func (listener *Listener) Close() error {
+	return listener.file.Close()
+}
+
+func Dial(cid, port uint32) (*os.File, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = unix.Connect(fd, &unix.SockaddrVM{CID: cid, Port: port}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	if err = unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(fd), "vsock:"+strconv.FormatUint(uint64(cid), 10)), nil
+}
@@ -21,14 +21,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"github.com/Dviih/golinux/config"
+	"github.com/Dviih/golinux/crash"
 	"github.com/Dviih/golinux/util"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -105,9 +111,24 @@ var (
 
 			pkg := config.Package(name)
 
-			log.InfoContext(ctx, "requested package build", slog.String("package", pkg.Name()))
+			build, err := config.NewBuild(version)
+			if err != nil {
+				return err
+			}
+
+			defer build.Close()
 
-			if err := buildPackage(ctx, config, pkg); err != nil {
+			log.InfoContext(ctx, "requested package build",
+				slog.String("package", pkg.Name()),
+				slog.String("build", build.ID()),
+			)
+
+			var binary string
+
+			if err = build.Time("package", func() (err error) {
+				binary, err = buildPackage(ctx, config, pkg)
+				return err
+			}); err != nil {
 				log.ErrorContext(ctx, "failed to build package",
 					slog.String("package", name),
 					slog.Any("error", err),
@@ -120,7 +141,9 @@ var (
 
 			log.InfoContext(ctx, "requested kernel build", slog.String("kernel", kernel.Name()))
 
-			if err := kernel.Build(ctx, nil); err != nil {
+			if err = build.Time("kernel", func() error {
+				return kernel.Build(ctx, nil)
+			}); err != nil {
 				log.ErrorContext(ctx, "failed to build kernel",
 					slog.String("kernel", kernel.Name()),
 					slog.Any("error", err),
@@ -129,6 +152,603 @@ var (
 				return err
 			}
 
+			if kernel.UKI != nil {
+				log.InfoContext(ctx, "unified kernel image built",
+					slog.String("kernel", kernel.Name()),
+					slog.String("path", kernel.UKIPath()),
+				)
+			}
+
+			if binary != "" {
+				if err = build.AddPackage(pkg, binary); err != nil {
+					return err
+				}
+			}
+
+			if err = build.AddInitramfs(); err != nil {
+				return err
+			}
+
+			if err = build.AddKernel(kernel); err != nil {
+				return err
+			}
+
+			if err = build.AddSBOM(ctx); err != nil {
+				return err
+			}
+
+			if err = build.Finish(ctx); err != nil {
+				return err
+			}
+
+			log.InfoContext(ctx, "build artifacts",
+				slog.String("build", build.ID()),
+				slog.String("path", build.Dir()),
+				slog.Int("artifacts", len(build.Manifest().Artifacts)),
+			)
+
+			return nil
+		},
+		"cmdline": func(ctx context.Context, config *config.Config) error {
+			if flag.Arg(1) == "" {
+				kernel := config.Kernel(config.UseKernel)
+
+				log.InfoContext(ctx, "cmdline result",
+					slog.String("kernel", kernel.Name()),
+					slog.String("builtin", strings.Join(kernel.GetCmdline(), " ")),
+				)
+
+				return nil
+			}
+
+			runner := config.Runner(flag.Arg(1))
+
+			log.InfoContext(ctx, "cmdline result",
+				slog.String("runner", runner.Name()),
+				slog.String("kernel", runner.GetKernel().Name()),
+				slog.String("builtin", strings.Join(runner.GetKernel().GetCmdline(), " ")),
+				slog.String("append", strings.Join(runner.GetCmdline(), " ")),
+				slog.String("boot", strings.Join(runner.BootCmdline(), " ")),
+			)
+
+			return nil
+		},
+		"test": func(ctx context.Context, config *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing runner name")
+			}
+
+			runner := config.Runner(flag.Arg(1))
+
+			log.InfoContext(ctx, "requested boot test", slog.String("runner", runner.Name()))
+
+			result, err := runner.RunTest(ctx, os.Stdout)
+			if err != nil {
+				return err
+			}
+
+			attributes := []any{
+				slog.String("runner", runner.Name()),
+				slog.Bool("passed", result.Passed),
+				slog.String("reason", result.Reason),
+				slog.String("log", result.Log),
+				slog.Duration("duration", result.Duration),
+			}
+
+			if result.Match != "" {
+				attributes = append(attributes, slog.String("match", result.Match))
+			}
+
+			if result.Err != nil {
+				attributes = append(attributes, slog.Any("error", result.Err))
+			}
+
+			reportCrashes(ctx, runner, result.Crashes)
+
+			if !result.Passed {
+				log.ErrorContext(ctx, "boot test failed", attributes...)
+				return errors.New("boot test failed: " + result.Reason)
+			}
+
+			log.InfoContext(ctx, "boot test passed", attributes...)
+			return nil
+		},
+		"gotest": func(ctx context.Context, c *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing runner name")
+			}
+
+			pkg := flag.Arg(2)
+			if pkg == "" {
+				pkg = "."
+			}
+
+			runner := c.Runner(flag.Arg(1))
+
+			log.InfoContext(ctx, "requested go test",
+				slog.String("runner", runner.Name()),
+				slog.String("package", pkg),
+			)
+
+			var passed, failed, skipped int
+
+			code, err := runner.GoTest(ctx, pkg, flag.Args()[min(3, flag.NArg()):], nil, func(event *config.TestEvent) {
+				if event.Action == "output" {
+					os.Stdout.WriteString(event.Output)
+					return
+				}
+
+				if event.Test == "" {
+					return
+				}
+
+				switch event.Action {
+				case "pass":
+					passed++
+				case "fail":
+					failed++
+				case "skip":
+					skipped++
+				default:
+					return
+				}
+
+				attributes := []any{
+					slog.String("package", event.Package),
+					slog.String("test", event.Test),
+					slog.Float64("elapsed", event.Elapsed),
+				}
+
+				if event.Action == "fail" {
+					log.ErrorContext(ctx, "test "+event.Action, attributes...)
+					return
+				}
+
+				log.InfoContext(ctx, "test "+event.Action, attributes...)
+			})
+			if err != nil {
+				return err
+			}
+
+			log.InfoContext(ctx, "go test result",
+				slog.String("runner", runner.Name()),
+				slog.String("package", pkg),
+				slog.Int("passed", passed),
+				slog.Int("failed", failed),
+				slog.Int("skipped", skipped),
+				slog.Int("code", code),
+			)
+
+			if code != 0 {
+				return &config.ExitError{Code: code}
+			}
+
+			return nil
+		},
+		"exec": func(ctx context.Context, config *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing runner name")
+			}
+
+			command := flag.Args()[min(2, flag.NArg()):]
+			if len(command) > 0 && command[0] == "--" {
+				command = command[1:]
+			}
+
+			if len(command) == 0 {
+				return errors.New("missing command")
+			}
+
+			log.InfoContext(ctx, "requested guest exec",
+				slog.String("runner", flag.Arg(1)),
+				slog.Any("command", command),
+			)
+
+			return config.Runner(flag.Arg(1)).Exec(ctx, os.Stdin, os.Stdout, os.Stderr, command...)
+		},
+		"disks": func(ctx context.Context, config *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing runner name")
+			}
+
+			runner := config.Runner(flag.Arg(1))
+
+			log.InfoContext(ctx, "requested disk creation",
+				slog.String("runner", runner.Name()),
+				slog.Int("disks", len(runner.Disks)),
+				slog.Bool("force", flag.Arg(2) == "force"),
+			)
+
+			return runner.CreateDisks(ctx, flag.Arg(2) == "force")
+		},
+		"qmp": func(ctx context.Context, config *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing runner name")
+			}
+
+			if flag.Arg(2) == "" {
+				return errors.New("missing qmp command")
+			}
+
+			client, err := config.Runner(flag.Arg(1)).QMP(ctx)
+			if err != nil {
+				return err
+			}
+
+			defer client.Close()
+
+			var (
+				command   = flag.Arg(2)
+				arguments interface{}
+				result    json.RawMessage
+			)
+
+			switch command {
+			case "status":
+				command = "query-status"
+			case "pause":
+				command = "stop"
+			case "resume":
+				command = "cont"
+			case "powerdown":
+				command = "system_powerdown"
+			case "reset":
+				command = "system_reset"
+			case "snapshot", "restore":
+				if flag.Arg(3) == "" {
+					return errors.New("missing snapshot name")
+				}
+
+				line := "savevm " + flag.Arg(3)
+				if command == "restore" {
+					line = "loadvm " + flag.Arg(3)
+				}
+
+				command = "human-monitor-command"
+				arguments = map[string]string{"command-line": line}
+			default:
+				if flag.Arg(3) != "" {
+					arguments = json.RawMessage(flag.Arg(3))
+				}
+			}
+
+			if err = client.Execute(ctx, command, arguments, &result); err != nil {
+				return err
+			}
+
+			log.InfoContext(ctx, "qmp result",
+				slog.String("runner", flag.Arg(1)),
+				slog.String("command", command),
+				slog.String("return", string(result)),
+			)
+
+			return nil
+		},
+		"debug": func(ctx context.Context, c *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing runner name")
+			}
+
+			port := config.DefaultGDBPort
+
+			if flag.Arg(2) != "" {
+				p, err := strconv.Atoi(flag.Arg(2))
+				if err != nil {
+					return err
+				}
+
+				port = p
+			}
+
+			runner := c.Runner(flag.Arg(1))
+			kernel := runner.GetKernel()
+
+			debug, err := runner.Debug(port)
+			if err != nil {
+				return err
+			}
+
+			changed, err := kernel.EnsureOptions(ctx, config.DebugKernelOptions)
+			if err != nil {
+				log.ErrorContext(ctx, "failed to check kernel debug options",
+					slog.String("kernel", kernel.Name()),
+					slog.Any("error", err),
+				)
+
+				return err
+			}
+
+			if changed {
+				log.InfoContext(ctx, "kernel debug options changed, rebuilding", slog.String("kernel", kernel.Name()))
+
+				if err = kernel.Build(ctx, nil); err != nil {
+					log.ErrorContext(ctx, "failed to build kernel",
+						slog.String("kernel", kernel.Name()),
+						slog.Any("error", err),
+					)
+
+					return err
+				}
+			}
+
+			gdbinit, err := debug.WriteGDBInit()
+			if err != nil {
+				return err
+			}
+
+			log.InfoContext(ctx, "runner waiting for debugger",
+				slog.String("runner", runner.Name()),
+				slog.Int("port", port),
+				slog.String("gdb", "gdb -x "+gdbinit),
+			)
+
+			return debug.Execute(ctx, os.Stdin, os.Stdout, os.Stderr)
+		},
+		"up": func(ctx context.Context, config *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing runner name")
+			}
+
+			instance, err := config.Runner(flag.Arg(1)).Up(ctx, flag.Arg(2))
+			if err != nil {
+				return err
+			}
+
+			pid, _ := instance.Pid()
+
+			log.InfoContext(ctx, "instance started",
+				slog.String("runner", flag.Arg(1)),
+				slog.String("instance", instance.Name()),
+				slog.Int("pid", pid),
+				slog.String("log", instance.Log()),
+			)
+
+			return nil
+		},
+		"ps": func(ctx context.Context, config *config.Config) error {
+			instances, err := config.Instances()
+			if err != nil {
+				return err
+			}
+
+			for _, instance := range instances {
+				pid, _ := instance.Pid()
+
+				log.InfoContext(ctx, "instance",
+					slog.String("instance", instance.Name()),
+					slog.String("state", instance.State(ctx)),
+					slog.Int("pid", pid),
+					slog.Duration("uptime", instance.Uptime().Truncate(time.Second)),
+				)
+			}
+
+			return nil
+		},
+		"console": func(ctx context.Context, config *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing instance name")
+			}
+
+			ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+			defer cancel()
+
+			return config.Instance(flag.Arg(1)).Console(ctx, os.Stdin, os.Stdout)
+		},
+		"down": func(ctx context.Context, c *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing instance name")
+			}
+
+			timeout := config.DefaultDownTimeout
+
+			if flag.Arg(2) != "" {
+				d, err := time.ParseDuration(flag.Arg(2))
+				if err != nil {
+					return err
+				}
+
+				timeout = d
+			}
+
+			instance := c.Instance(flag.Arg(1))
+
+			log.InfoContext(ctx, "stopping instance",
+				slog.String("instance", instance.Name()),
+				slog.Duration("timeout", timeout),
+			)
+
+			return instance.Down(ctx, timeout)
+		},
+		"topology": func(ctx context.Context, c *config.Config) error {
+			if flag.Arg(1) == "" {
+				log.InfoContext(ctx, "topologies result",
+					slog.String("project", c.Project),
+					slog.Any("topologies", Keys(c.Topologies)),
+				)
+
+				return nil
+			}
+
+			if flag.Arg(2) == "" {
+				return errors.New("missing topology name")
+			}
+
+			topology := c.Topology(flag.Arg(2))
+
+			switch flag.Arg(1) {
+			case "up":
+				log.InfoContext(ctx, "starting topology",
+					slog.String("topology", topology.Name()),
+					slog.Any("nodes", topology.Names()),
+				)
+
+				instances, err := topology.Up(ctx)
+				if err != nil {
+					return err
+				}
+
+				for _, instance := range instances {
+					pid, _ := instance.Pid()
+
+					log.InfoContext(ctx, "instance started",
+						slog.String("instance", instance.Name()),
+						slog.Int("pid", pid),
+						slog.String("log", instance.Log()),
+					)
+				}
+
+				return nil
+			case "down":
+				timeout := config.DefaultDownTimeout
+
+				if flag.Arg(3) != "" {
+					d, err := time.ParseDuration(flag.Arg(3))
+					if err != nil {
+						return err
+					}
+
+					timeout = d
+				}
+
+				log.InfoContext(ctx, "stopping topology",
+					slog.String("topology", topology.Name()),
+					slog.Duration("timeout", timeout),
+				)
+
+				return topology.Down(ctx, timeout)
+			case "ps":
+				for _, instance := range topology.Instances() {
+					pid, _ := instance.Pid()
+
+					log.InfoContext(ctx, "instance",
+						slog.String("instance", instance.Name()),
+						slog.String("state", instance.State(ctx)),
+						slog.Int("pid", pid),
+						slog.Duration("uptime", instance.Uptime().Truncate(time.Second)),
+					)
+				}
+
+				return nil
+			case "logs":
+				ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+				defer cancel()
+
+				return topology.Logs(ctx, os.Stdout, flag.Arg(3) != "once")
+			default:
+				return errors.New("usage: topology [up|down|ps|logs] <name>")
+			}
+		},
+		"export": func(ctx context.Context, config *config.Config) error {
+			if flag.Arg(1) == "" {
+				return errors.New("missing runner name")
+			}
+
+			format := flag.Arg(2)
+			if format == "" {
+				format = "disk"
+			}
+
+			runner := config.Runner(flag.Arg(1))
+
+			log.InfoContext(ctx, "requested export",
+				slog.String("runner", runner.Name()),
+				slog.String("format", format),
+			)
+
+			output, err := runner.Export(ctx, format, flag.Arg(3))
+			if err != nil {
+				return err
+			}
+
+			log.InfoContext(ctx, "export result",
+				slog.String("runner", runner.Name()),
+				slog.String("format", format),
+				slog.String("output", output),
+			)
+
+			return nil
+		},
+		"bench": func(ctx context.Context, config *config.Config) error {
+			switch flag.Arg(1) {
+			case "boot", "baseline":
+			default:
+				return errors.New("usage: bench boot <runner> [runs] | bench baseline <runner>")
+			}
+
+			if flag.Arg(2) == "" {
+				return errors.New("missing runner name")
+			}
+
+			runner := config.Runner(flag.Arg(2))
+
+			if flag.Arg(1) == "baseline" {
+				if err := runner.MarkBootBaseline(); err != nil {
+					return err
+				}
+
+				log.InfoContext(ctx, "marked boot baseline", slog.String("runner", runner.Name()))
+				return nil
+			}
+
+			runs := 5
+
+			if flag.Arg(3) != "" {
+				n, err := strconv.Atoi(flag.Arg(3))
+				if err != nil {
+					return err
+				}
+
+				runs = n
+			}
+
+			log.InfoContext(ctx, "requested boot benchmark",
+				slog.String("runner", runner.Name()),
+				slog.Int("runs", runs),
+			)
+
+			history, err := runner.BootHistory()
+			if err != nil {
+				return err
+			}
+
+			record, err := runner.BenchBoot(ctx, runs)
+			if err != nil {
+				return err
+			}
+
+			for _, stats := range record.Stats {
+				log.InfoContext(ctx, "boot phase",
+					slog.String("phase", stats.Phase),
+					slog.Int("runs", stats.Runs),
+					slog.Duration("min", stats.Min),
+					slog.Duration("median", stats.Median),
+					slog.Duration("p95", stats.P95),
+				)
+			}
+
+			if err = runner.SaveBootRecord(record); err != nil {
+				return err
+			}
+
+			baseline, regressions := record.Compare(history)
+			if baseline == nil {
+				log.InfoContext(ctx, "no boot baseline to compare against", slog.String("runner", runner.Name()))
+				return nil
+			}
+
+			for _, regression := range regressions {
+				log.WarnContext(ctx, "boot regression",
+					slog.String("phase", regression.Phase),
+					slog.Duration("baseline", regression.Baseline),
+					slog.Duration("current", regression.Current),
+					slog.Time("baseline_time", baseline.Time),
+				)
+			}
+
+			if len(regressions) > 0 {
+				return errors.New("boot time regressed")
+			}
+
 			return nil
 		},
 		"run": func(ctx context.Context, config *config.Config) error {
@@ -136,7 +756,13 @@ var (
 				return errors.New("missing runner name")
 			}
 
-			return config.Runner(flag.Arg(1)).Execute(ctx, os.Stdin, os.Stdout, os.Stderr)
+			runner := config.Runner(flag.Arg(1))
+			parser := crash.NewParser()
+
+			err := runner.Execute(ctx, os.Stdin, io.MultiWriter(os.Stdout, parser), io.MultiWriter(os.Stderr, parser))
+			reportCrashes(ctx, runner, parser.Reports())
+
+			return err
 		},
 	}
 
@@ -153,13 +779,50 @@ func Keys[K comparable, V any](m map[K]V) []K {
 	return keys
 }
 
-func buildPackage(ctx context.Context, config *config.Config, pkg *config.Package) error {
+func reportCrashes(ctx context.Context, runner *config.Runner, reports []*crash.Report) {
+	if len(reports) == 0 {
+		return
+	}
+
+	if err := runner.Symbolize(ctx, reports); err != nil {
+		log.WarnContext(ctx, "failed to symbolize crash reports",
+			slog.String("runner", runner.Name()),
+			slog.Any("error", err),
+		)
+	}
+
+	for _, report := range reports {
+		log.ErrorContext(ctx, "crash detected",
+			slog.String("runner", runner.Name()),
+			slog.String("kind", report.Kind.String()),
+			slog.String("reason", report.Reason),
+			slog.String("location", report.Location),
+		)
+
+		os.Stderr.WriteString(report.String())
+	}
+}
+
+func buildPackage(ctx context.Context, config *config.Config, pkg *config.Package) (string, error) {
 	log.InfoContext(ctx, "build requested",
 		slog.String("project", config.Project),
 		slog.String("kernel", config.UseKernel),
 		slog.String("package", path.Base(pkg.Path)),
 	)
 
+	if pkg.IsModule() {
+		if err := pkg.Build(ctx, nil); err != nil {
+			log.ErrorContext(ctx, "failed to build module package",
+				slog.String("package", pkg.Name()),
+				slog.Any("error", err),
+			)
+
+			return "", err
+		}
+
+		return "", nil
+	}
+
 	target := pkg.Name()
 	if target == config.DefaultPackage {
 		target = "init"
@@ -172,7 +835,7 @@ func buildPackage(ctx context.Context, config *config.Config, pkg *config.Packag
 			slog.Any("error", err),
 		)
 
-		return err
+		return "", err
 	}
 
 	defer func(file *os.File) {
@@ -190,10 +853,10 @@ func buildPackage(ctx context.Context, config *config.Config, pkg *config.Packag
 			slog.Any("error", err),
 		)
 
-		return err
+		return "", err
 	}
 
-	return nil
+	return file.Name(), nil
 }
 
 func main() {
@@ -217,12 +880,12 @@ func main() {
 	c, err := config.FromPath(ConfigPath)
 	if err != nil {
 		log.ErrorContext(ctx, "failed to initialize config from path", slog.Any("error", err))
-		return
+		os.Exit(1)
 	}
 
 	if flag.NArg() < 1 {
 		log.ErrorContext(ctx, "unspecified command", slog.Any("available", commandsNames))
-		return
+		os.Exit(1)
 	}
 
 	command, ok := commands[strings.ToLower(flag.Arg(0))]
@@ -232,7 +895,7 @@ func main() {
 			slog.Any("available", commandsNames),
 		)
 
-		return
+		os.Exit(1)
 	}
 
 	log.InfoContext(ctx, "command requested", slog.String("command", flag.Arg(0)))
@@ -243,7 +906,12 @@ func main() {
 			slog.Any("error", err),
 		)
 
-		return
+		var exitError *config.ExitError
+		if errors.As(err, &exitError) {
+			os.Exit(exitError.Code)
+		}
+
+		os.Exit(1)
 	}
 
 	log.InfoContext(ctx, "command execution done", slog.String("command", flag.Arg(0)))
@@ -27,7 +27,8 @@ import (
 )
 
 var (
-	wd string
+	wd      string
+	program *tea.Program
 )
 
 func main() {
@@ -47,9 +48,13 @@ func main() {
 		StateKernels:   NewList("Kernels", c.Kernels),
 		StatePackages:  NewList("Packages", c.Packages),
 		StateRunners:   NewList("Runners", c.Runners),
+
+		StateTopologies: NewList("Topologies", c.Topologies),
 	}
 
-	if _, err := tea.NewProgram(model, tea.WithAltScreen()).Run(); err != nil {
+	program = tea.NewProgram(model, tea.WithAltScreen())
+
+	if _, err := program.Run(); err != nil {
 		panic(err)
 	}
 }
@@ -46,6 +46,8 @@ type Exec struct {
 	selected    int
 
 	done    bool
+	Title   string
+	Prompt  string
 	Handler func(*tea.Program, string) func()
 }
 
@@ -65,7 +67,7 @@ func (exec *Exec) Init() tea.Cmd {
 	delegation.ShowDescription = false
 
 	exec.selectList = list.New(items, delegation, 0, 0)
-	exec.selectList.Title = "Select a package to build"
+	exec.selectList.Title = exec.Prompt
 	return nil
 }
 
@@ -84,7 +86,9 @@ func (exec *Exec) Update(msg tea.Msg) (*Exec, tea.Cmd) {
 				exec.viewport.Width = exec.selectList.Width()
 				exec.viewport.Height = exec.selectList.Height() - 10
 
-				exec.Handler(exec.program, exec.options[exec.selected])
+				if handler := exec.Handler(exec.program, exec.options[exec.selected]); handler != nil {
+					go handler()
+				}
 			}
 		}
 
@@ -133,7 +137,7 @@ func (exec *Exec) View() string {
 }
 
 func (exec *Exec) header() string {
-	title := exec.Styles.Title.Render("Building kernel")
+	title := exec.Styles.Title.Render(exec.Title)
 	line := strings.Repeat("─", max(0, exec.viewport.Width-lipgloss.Width(title)))
 	return lipgloss.JoinHorizontal(lipgloss.Center, title, line)
 }
@@ -151,6 +155,8 @@ func (exec *Exec) Writer() io.Writer {
 func NewExec(options []string) *Exec {
 	exec := &Exec{
 		options: options,
+		Title:   "Building kernel",
+		Prompt:  "Select a package to build",
 	}
 
 	styles := list.DefaultStyles()
@@ -219,6 +219,27 @@ func (l *List) Init() tea.Cmd {
 					description: description,
 				})
 			}
+
+			if !rv.CanAddr() {
+				break
+			}
+
+			switch v := rv.Addr().Interface().(type) {
+			case *config.Runner:
+				items = append(items, &Item{
+					title: "Boot cmdline",
+					description: func() string {
+						return strings.Join(v.BootCmdline(), " ")
+					},
+				})
+			case *config.Kernel:
+				items = append(items, &Item{
+					title: "Builtin cmdline",
+					description: func() string {
+						return strings.Join(v.GetCmdline(), " ")
+					},
+				})
+			}
 		}
 	}
 
@@ -446,6 +467,10 @@ func (l *List) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					k++
 				}
 
+				if !field.IsValid() {
+					break
+				}
+
 				switch field.Kind() {
 				case reflect.Map, reflect.Slice, reflect.Struct:
 					back := *l
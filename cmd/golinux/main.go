@@ -20,6 +20,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/Dviih/golinux/config"
 	"github.com/charmbracelet/bubbles/help"
@@ -39,6 +40,7 @@ const (
 	StateKernels
 	StatePackages
 	StateRunners
+	StateTopologies
 	StateLast
 )
 
@@ -52,6 +54,7 @@ type HelpMap struct {
 	Rename  key.Binding
 	Build   key.Binding
 	Execute key.Binding
+	Logs    key.Binding
 }
 
 func (help *HelpMap) ShortHelp() []key.Binding {
@@ -60,7 +63,7 @@ func (help *HelpMap) ShortHelp() []key.Binding {
 
 func (help *HelpMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{help.Tab, help.Help, help.Config, help.Sync, help.Quit, help.Zoom, help.Rename},
+		{help.Tab, help.Help, help.Config, help.Sync, help.Quit, help.Zoom, help.Rename, help.Logs},
 	}
 }
 
@@ -74,6 +77,7 @@ var helpMap = &HelpMap{
 	Rename:  key.NewBinding(key.WithKeys(tea.KeyCtrlR.String()), key.WithHelp("control + r(ename)", "rename selected item")),
 	Build:   key.NewBinding(key.WithKeys(tea.KeyCtrlB.String()), key.WithHelp("control + b(uild)", "build a package")),
 	Execute: key.NewBinding(key.WithKeys(tea.KeyCtrlE.String()), key.WithHelp("control + e(execute)", "execute a package")),
+	Logs:    key.NewBinding(key.WithKeys(tea.KeyCtrlL.String()), key.WithHelp("control + l(ogs)", "follow topology logs")),
 }
 
 type Main struct {
@@ -87,6 +91,7 @@ type Main struct {
 	bindings *HelpMap
 	help     help.Model
 	exec     *Exec
+	logs     context.CancelFunc
 	style    lipgloss.Style
 
 	size  tea.WindowSizeMsg
@@ -219,6 +224,47 @@ func (main Main) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			main.exec.Init()
 			main.exec, cmd = main.exec.Update(main.size)
 
+			return main, tea.Batch(append(cmds, cmd)...)
+		case key.Matches(msg, main.bindings.Logs):
+			if main.configAreaActive {
+				break
+			}
+
+			if main.exec != nil {
+				if main.exec.done {
+					if main.logs != nil {
+						main.logs()
+						main.logs = nil
+					}
+
+					main.exec = nil
+				}
+
+				return main, nil
+			}
+
+			var topologies []string
+
+			for name := range main.config.Topologies {
+				topologies = append(topologies, name)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			main.logs = cancel
+
+			main.exec = NewExec(topologies)
+			main.exec.Title = "Topology logs"
+			main.exec.Prompt = "Select a topology to follow"
+			main.exec.program = program
+			main.exec.Handler = func(program *tea.Program, s string) func() {
+				return func() {
+					_ = main.config.Topology(s).Logs(ctx, &Writer{program: program}, true)
+				}
+			}
+
+			main.exec.Init()
+			main.exec, cmd = main.exec.Update(main.size)
+
 			return main, tea.Batch(append(cmds, cmd)...)
 		default:
 		}
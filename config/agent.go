@@ -0,0 +1,76 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"errors"
+	"github.com/Dviih/golinux/agent"
+	"io"
+	"strconv"
+)
+
+type RunnerVsock struct {
+	CID  uint32 `yaml:"cid"`
+	Port uint32 `yaml:"port"`
+}
+
+func (vsock *RunnerVsock) GetPort() uint32 {
+	if vsock.Port == 0 {
+		return agent.DefaultPort
+	}
+
+	return vsock.Port
+}
+
+func (runner *Runner) Agent() (*agent.Client, error) {
+	if runner.Vsock == nil || runner.Vsock.CID < 3 {
+		return nil, errors.New("runner has no vsock cid configured")
+	}
+
+	return agent.NewClient(runner.Vsock.CID, runner.Vsock.GetPort()), nil
+}
+
+func (runner *Runner) Exec(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, command ...string) error {
+	client, err := runner.Agent()
+	if err != nil {
+		return err
+	}
+
+	code, err := client.Exec(ctx, stdin, stdout, stderr, command...)
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		return &ExitError{Code: code}
+	}
+
+	return nil
+}
+
+func (runner *Runner) vsock() (KVS, []string) {
+	if runner.Vsock == nil || runner.Vsock.CID < 3 {
+		return nil, nil
+	}
+
+	return KVS{{Key: "device", Value: "vhost-vsock-pci,guest-cid=" + strconv.FormatUint(uint64(runner.Vsock.CID), 10)}},
+		[]string{"golinux.agent=" + strconv.FormatUint(uint64(runner.Vsock.GetPort()), 10)}
+}
@@ -0,0 +1,432 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ArtifactKernel    = "kernel"
+	ArtifactSystemMap = "system.map"
+	ArtifactVmlinux   = "vmlinux"
+	ArtifactConfig    = "config"
+	ArtifactInitramfs = "initramfs"
+	ArtifactPackage   = "package"
+	ArtifactUKI       = "uki"
+)
+
+// DefaultKeepBuilds is how many builds stay in out/ when keep_builds is unset,
+// a negative keep_builds keeps every build.
+const DefaultKeepBuilds = 10
+
+type Artifact struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Timing struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+type Manifest struct {
+	ID        string            `json:"id"`
+	Project   string            `json:"project"`
+	Version   string            `json:"version,omitempty"`
+	Kernel    string            `json:"kernel,omitempty"`
+	Arch      string            `json:"arch,omitempty"`
+	Release   string            `json:"release,omitempty"`
+	Created   time.Time         `json:"created"`
+	Toolchain map[string]string `json:"toolchain"`
+	Timings   []*Timing         `json:"timings"`
+	Artifacts []*Artifact       `json:"artifacts"`
+}
+
+func (manifest *Manifest) Artifact(kind string) *Artifact {
+	for _, artifact := range manifest.Artifacts {
+		if artifact.Kind == kind {
+			return artifact
+		}
+	}
+
+	return nil
+}
+
+type artifactSource struct {
+	kind string
+	name string
+	src  string
+}
+
+type Build struct {
+	manifest *Manifest
+	kernel   *Kernel
+	dir      string
+	keep     int
+	finished bool
+}
+
+func (config *Config) NewBuild(version string) (*Build, error) {
+	suffix := make([]byte, 3)
+
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	id := now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+
+	build := &Build{
+		manifest: &Manifest{
+			ID:        id,
+			Project:   config.Project,
+			Version:   version,
+			Created:   now,
+			Toolchain: make(map[string]string),
+		},
+		dir:  util.WDOut(config.Project, id),
+		keep: config.KeepBuilds,
+	}
+
+	if build.keep == 0 {
+		build.keep = DefaultKeepBuilds
+	}
+
+	if err := os.MkdirAll(build.dir, 0750); err != nil {
+		return nil, err
+	}
+
+	return build, nil
+}
+
+// Close removes the build directory unless the build was finished, so a failed
+// build leaves nothing behind in out/.
+func (build *Build) Close() error {
+	if build.finished {
+		return nil
+	}
+
+	return os.RemoveAll(build.dir)
+}
+
+func (build *Build) ID() string {
+	return build.manifest.ID
+}
+
+func (build *Build) Dir() string {
+	return build.dir
+}
+
+func (build *Build) Manifest() *Manifest {
+	return build.manifest
+}
+
+func (build *Build) Time(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+
+	build.manifest.Timings = append(build.manifest.Timings, &Timing{Name: name, Duration: time.Since(start)})
+	return err
+}
+
+func (build *Build) Add(kind, name, src string) (*Artifact, error) {
+	dst := path.Join(build.dir, name)
+
+	if err := os.MkdirAll(path.Dir(dst), 0750); err != nil {
+		return nil, err
+	}
+
+	if err := util.CopyFile(dst, src); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+
+	artifact := &Artifact{
+		Kind:   kind,
+		Name:   path.Base(name),
+		Path:   name,
+		Size:   size,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}
+
+	build.manifest.Artifacts = append(build.manifest.Artifacts, artifact)
+	return artifact, nil
+}
+
+func (kernel *Kernel) Arch() (string, error) {
+	options, err := kernel.Options()
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case options["CONFIG_X86_64"] == "y":
+		return "amd64", nil
+	case options["CONFIG_X86_32"] == "y":
+		return "386", nil
+	case options["CONFIG_ARM64"] == "y":
+		return "arm64", nil
+	case options["CONFIG_ARM"] == "y":
+		return "arm", nil
+	case options["CONFIG_RISCV"] == "y" && options["CONFIG_64BIT"] == "y":
+		return "riscv64", nil
+	default:
+		return "", errors.New("unknown arch for kernel " + kernel.Name())
+	}
+}
+
+func (build *Build) AddKernel(kernel *Kernel) error {
+	arch, err := kernel.Arch()
+	if err != nil {
+		return err
+	}
+
+	build.kernel = kernel
+	build.manifest.Kernel = kernel.Name()
+	build.manifest.Arch = arch
+
+	if build.manifest.Release, err = kernel.Release(); err != nil {
+		return err
+	}
+
+	if kernel.compiler != nil {
+		build.manifest.Toolchain["kernel"] = kernel.compiler.Call
+	}
+
+	image := archs[arch].Image
+
+	artifacts := []*artifactSource{
+		{ArtifactKernel, path.Base(image), path.Join(kernel.Path, image)},
+		{ArtifactSystemMap, "System.map", path.Join(kernel.Path, "System.map")},
+		{ArtifactConfig, "config", path.Join(kernel.Path, ".config")},
+	}
+
+	if kernel.KeepVmlinux {
+		artifacts = append(artifacts, &artifactSource{ArtifactVmlinux, "vmlinux", kernel.Vmlinux()})
+	}
+
+	if kernel.UKI != nil {
+		artifacts = append(artifacts, &artifactSource{ArtifactUKI, kernel.Name() + ".efi", kernel.UKIPath()})
+	}
+
+	for _, artifact := range artifacts {
+		if _, err = build.Add(artifact.kind, artifact.name, artifact.src); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (build *Build) AddInitramfs() error {
+	archive := path.Join(build.dir, "initramfs.cpio.tmp")
+	defer os.Remove(archive)
+
+	if err := util.WriteCPIO(archive, util.WDInitramfs(build.manifest.Project)); err != nil {
+		return err
+	}
+
+	_, err := build.Add(ArtifactInitramfs, "initramfs.cpio", archive)
+	return err
+}
+
+func (build *Build) AddPackage(pkg *Package, binary string) error {
+	_, err := build.Add(ArtifactPackage, path.Join("packages", pkg.Name()), binary)
+	return err
+}
+
+func toolchainVersion(ctx context.Context, name string, args ...string) string {
+	output, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return ""
+	}
+
+	line, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(line)
+}
+
+func (build *Build) Finish(ctx context.Context) error {
+	if version := toolchainVersion(ctx, "go", "env", "GOVERSION"); version != "" {
+		build.manifest.Toolchain["go"] = version
+	}
+
+	if version := toolchainVersion(ctx, "cc", "--version"); version != "" {
+		build.manifest.Toolchain["cc"] = version
+	}
+
+	data, err := json.MarshalIndent(build.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(path.Join(build.dir, "manifest.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	latest := util.WDOut(build.manifest.Project, "latest")
+	temporary := latest + ".tmp"
+
+	if err = os.Remove(temporary); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err = os.Symlink(build.manifest.ID, temporary); err != nil {
+		return err
+	}
+
+	if err = os.Rename(temporary, latest); err != nil {
+		return err
+	}
+
+	build.finished = true
+	return build.prune()
+}
+
+// prune removes the oldest builds beyond the retention limit, build ids start
+// with their creation time so they sort chronologically.
+func (build *Build) prune() error {
+	if build.keep < 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(util.WDOut(build.manifest.Project))
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == build.manifest.ID {
+			continue
+		}
+
+		if util.Exists(util.WDOut(build.manifest.Project, entry.Name(), "manifest.json")) {
+			ids = append(ids, entry.Name())
+		}
+	}
+
+	slices.Sort(ids)
+
+	var errs []error
+
+	for len(ids) >= build.keep {
+		if err = os.RemoveAll(util.WDOut(build.manifest.Project, ids[0])); err != nil {
+			errs = append(errs, err)
+		}
+
+		ids = ids[1:]
+	}
+
+	return errors.Join(errs...)
+}
+
+func LatestManifest(project string) (*Manifest, error) {
+	data, err := os.ReadFile(util.WDOut(project, "latest", "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	return manifest, json.Unmarshal(data, manifest)
+}
+
+func (runner *Runner) artifact(kind, fallback string) string {
+	manifest, err := LatestManifest(runner.project)
+	if err != nil || manifest.Kernel != runner.GetKernel().Name() || manifest.Arch != runner.GetArch() {
+		return ""
+	}
+
+	artifact := manifest.Artifact(kind)
+	if artifact == nil {
+		return ""
+	}
+
+	name := util.WDOut(runner.project, "latest", artifact.Path)
+
+	stat, err := os.Stat(name)
+	if err != nil {
+		return ""
+	}
+
+	// a tree rebuilt after the last build, e.g. for debugging, takes precedence.
+	if current, err := newest(fallback); err == nil && current.After(stat.ModTime()) {
+		return ""
+	}
+
+	return name
+}
+
+// newest returns the latest modification time of name or anything below it,
+// a directory's own mtime only changes when entries are added or removed.
+func newest(name string) (time.Time, error) {
+	var latest time.Time
+
+	err := filepath.WalkDir(name, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+
+		return nil
+	})
+
+	return latest, err
+}
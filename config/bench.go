@@ -0,0 +1,329 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const BootRegressionThreshold = 1.10
+
+const (
+	BootPhaseInit      = "init"
+	BootPhaseUserspace = "userspace"
+	BootPhaseSuccess   = "success"
+)
+
+var BootPhases = []string{BootPhaseInit, BootPhaseUserspace, BootPhaseSuccess}
+
+type BootStats struct {
+	Phase  string        `json:"phase"`
+	Runs   int           `json:"runs"`
+	Min    time.Duration `json:"min"`
+	Median time.Duration `json:"median"`
+	P95    time.Duration `json:"p95"`
+}
+
+type BootRecord struct {
+	Time     time.Time    `json:"time"`
+	Runner   string       `json:"runner"`
+	Runs     int          `json:"runs"`
+	Failed   int          `json:"failed"`
+	Baseline bool         `json:"baseline"`
+	Stats    []*BootStats `json:"stats"`
+}
+
+type BootRegression struct {
+	Phase    string
+	Baseline time.Duration
+	Current  time.Duration
+}
+
+// bootTimer measures phases from the first console byte, so host preparation
+// such as writing the initramfs or creating disks is not part of the boot.
+type bootTimer struct {
+	m       sync.Mutex
+	start   time.Time
+	line    []byte
+	phases  map[string]time.Duration
+	success []*regexp.Regexp
+}
+
+func (timer *bootTimer) Write(data []byte) (int, error) {
+	defer timer.m.Unlock()
+	timer.m.Lock()
+
+	if timer.start.IsZero() && len(data) > 0 {
+		timer.start = time.Now()
+	}
+
+	for _, b := range data {
+		if b != '\n' {
+			timer.line = append(timer.line, b)
+			continue
+		}
+
+		timer.mark(strings.TrimRight(string(timer.line), "\r"))
+		timer.line = timer.line[:0]
+	}
+
+	return len(data), nil
+}
+
+func (timer *bootTimer) set(phase string) {
+	if _, ok := timer.phases[phase]; !ok && !timer.start.IsZero() {
+		timer.phases[phase] = time.Since(timer.start)
+	}
+}
+
+func (timer *bootTimer) mark(line string) {
+	_, init := timer.phases[BootPhaseInit]
+
+	switch {
+	case strings.Contains(line, "Run /") && strings.Contains(line, "as init process"):
+		timer.set(BootPhaseInit)
+	case init && strings.TrimSpace(line) != "":
+		timer.set(BootPhaseUserspace)
+	}
+
+	for _, re := range timer.success {
+		if re.MatchString(line) {
+			timer.set(BootPhaseSuccess)
+		}
+	}
+}
+
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	i := int(float64(len(durations))*p+0.5) - 1
+	return durations[max(0, min(i, len(durations)-1))]
+}
+
+func (runner *Runner) BenchBoot(ctx context.Context, runs int) (*BootRecord, error) {
+	if runs <= 0 {
+		runs = 1
+	}
+
+	success, err := compileRegexps(runner.GetTest().Success)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &BootRecord{Time: time.Now(), Runner: runner.Name(), Runs: runs}
+	samples := make(map[string][]time.Duration)
+
+	for i := 0; i < runs; i++ {
+		timer := &bootTimer{phases: make(map[string]time.Duration), success: success}
+
+		result, err := runner.RunTest(ctx, timer)
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Passed {
+			record.Failed++
+			continue
+		}
+
+		if len(success) == 0 {
+			timer.set(BootPhaseSuccess)
+		}
+
+		for phase, duration := range timer.phases {
+			samples[phase] = append(samples[phase], duration)
+		}
+	}
+
+	for _, phase := range BootPhases {
+		durations := samples[phase]
+		if len(durations) == 0 {
+			continue
+		}
+
+		slices.Sort(durations)
+
+		record.Stats = append(record.Stats, &BootStats{
+			Phase:  phase,
+			Runs:   len(durations),
+			Min:    durations[0],
+			Median: percentile(durations, 0.5),
+			P95:    percentile(durations, 0.95),
+		})
+	}
+
+	if record.Failed == runs {
+		return record, errors.New("every boot failed")
+	}
+
+	return record, nil
+}
+
+func bootHistory(project string) string {
+	return util.WDProject(project, "bench", "boot.jsonl")
+}
+
+func (runner *Runner) BootHistory() ([]*BootRecord, error) {
+	file, err := os.Open(bootHistory(runner.project))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var records []*BootRecord
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		record := &BootRecord{}
+
+		if err = json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return nil, err
+		}
+
+		if record.Runner == runner.Name() {
+			records = append(records, record)
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+func (runner *Runner) SaveBootRecord(record *BootRecord) error {
+	name := bootHistory(runner.project)
+
+	if err := os.MkdirAll(path.Dir(name), 0750); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if err = json.NewEncoder(file).Encode(record); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (runner *Runner) MarkBootBaseline() error {
+	data, err := os.ReadFile(bootHistory(runner.project))
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	latest := -1
+
+	records := make([]*BootRecord, len(lines))
+
+	for i, line := range lines {
+		records[i] = &BootRecord{}
+
+		if err = json.Unmarshal([]byte(line), records[i]); err != nil {
+			return err
+		}
+
+		if records[i].Runner == runner.Name() {
+			latest = i
+		}
+	}
+
+	if latest == -1 {
+		return errors.New("no boot records for runner " + runner.Name())
+	}
+
+	var builder strings.Builder
+
+	for i, record := range records {
+		if record.Runner == runner.Name() {
+			record.Baseline = i == latest
+		}
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		builder.Write(append(line, '\n'))
+	}
+
+	return os.WriteFile(bootHistory(runner.project), []byte(builder.String()), 0644)
+}
+
+func (record *BootRecord) Compare(history []*BootRecord) (*BootRecord, []*BootRegression) {
+	var baseline *BootRecord
+
+	for _, r := range history {
+		if r.Baseline {
+			baseline = r
+		}
+	}
+
+	if baseline == nil && len(history) > 0 {
+		baseline = history[len(history)-1]
+	}
+
+	if baseline == nil {
+		return nil, nil
+	}
+
+	var regressions []*BootRegression
+
+	for _, current := range record.Stats {
+		for _, previous := range baseline.Stats {
+			if current.Phase != previous.Phase {
+				continue
+			}
+
+			if float64(current.Median) > float64(previous.Median)*BootRegressionThreshold {
+				regressions = append(regressions, &BootRegression{
+					Phase:    current.Phase,
+					Baseline: previous.Median,
+					Current:  current.Median,
+				})
+			}
+		}
+	}
+
+	return baseline, regressions
+}
@@ -0,0 +1,110 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"strings"
+)
+
+var (
+	kernelCmdline = []string{"rdinit=/init"}
+
+	// single valued parameters, a later value replaces the earlier one.
+	cmdlineOverrides = map[string]bool{
+		"rdinit":     true,
+		"init":       true,
+		"root":       true,
+		"rootfstype": true,
+		"loglevel":   true,
+		"panic":      true,
+		"reboot":     true,
+		"pci":        true,
+	}
+)
+
+func cmdlineOverride(key string) bool {
+	return cmdlineOverrides[key] || strings.HasPrefix(key, "golinux.")
+}
+
+func MergeCmdline(cmdlines ...[]string) []string {
+	var (
+		merged []string
+		init   []string
+		keys   = make(map[string]int)
+	)
+
+	for _, cmdline := range cmdlines {
+		arguments := false
+
+		for _, parameter := range cmdline {
+			for _, parameter := range strings.Fields(parameter) {
+				if arguments {
+					init = append(init, parameter)
+					continue
+				}
+
+				if parameter == "--" {
+					arguments = true
+					continue
+				}
+
+				key, _, _ := strings.Cut(parameter, "=")
+
+				if !cmdlineOverride(key) {
+					key = parameter
+				}
+
+				if i, ok := keys[key]; ok {
+					merged[i] = parameter
+					continue
+				}
+
+				keys[key] = len(merged)
+				merged = append(merged, parameter)
+			}
+		}
+	}
+
+	if len(init) > 0 {
+		merged = append(append(merged, "--"), init...)
+	}
+
+	return merged
+}
+
+func (kernel *Kernel) GetCmdline() []string {
+	if len(kernel.Cmdline) == 0 {
+		return nil
+	}
+
+	return MergeCmdline(kernelCmdline, kernel.Cmdline)
+}
+
+func (runner *Runner) GetCmdline() []string {
+	return MergeCmdline([]string{"console=" + runner.GetConsole()}, kernelCmdline, runner.Cmdline)
+}
+
+func (runner *Runner) BootCmdline() []string {
+	if runner.kernel == nil {
+		return runner.GetCmdline()
+	}
+
+	return MergeCmdline(runner.kernel.GetCmdline(), runner.GetCmdline())
+}
@@ -0,0 +1,76 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMergeCmdline(t *testing.T) {
+	tests := []struct {
+		name     string
+		cmdlines [][]string
+		expected []string
+	}{
+		{
+			name:     "override",
+			cmdlines: [][]string{{"rdinit=/init", "loglevel=3"}, {"loglevel=7", "rdinit=/sbin/init"}},
+			expected: []string{"rdinit=/sbin/init", "loglevel=7"},
+		},
+		{
+			name:     "golinux override",
+			cmdlines: [][]string{{"golinux.net=up"}, {"golinux.net=10.0.2.15/24,10.0.2.2"}},
+			expected: []string{"golinux.net=10.0.2.15/24,10.0.2.2"},
+		},
+		{
+			name:     "bare flags",
+			cmdlines: [][]string{{"quiet", "nokaslr"}, {"quiet", "debug"}},
+			expected: []string{"quiet", "nokaslr", "debug"},
+		},
+		{
+			name:     "duplicate keys",
+			cmdlines: [][]string{{"console=ttyS0", "console=tty0"}, {"console=ttyS0", "modprobe.blacklist=a"}, {"modprobe.blacklist=b"}},
+			expected: []string{"console=ttyS0", "console=tty0", "modprobe.blacklist=a", "modprobe.blacklist=b"},
+		},
+		{
+			name:     "fields",
+			cmdlines: [][]string{{"console=ttyS0 quiet"}, {"quiet  panic=1"}},
+			expected: []string{"console=ttyS0", "quiet", "panic=1"},
+		},
+		{
+			name:     "init arguments",
+			cmdlines: [][]string{{"rdinit=/init", "--", "-v", "loglevel=1"}, {"loglevel=7", "--", "-v"}},
+			expected: []string{"rdinit=/init", "loglevel=7", "--", "-v", "loglevel=1", "-v"},
+		},
+		{
+			name:     "empty",
+			cmdlines: [][]string{nil, {}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if merged := MergeCmdline(test.cmdlines...); !slices.Equal(merged, test.expected) {
+				t.Errorf("got %q, want %q", merged, test.expected)
+			}
+		})
+	}
+}
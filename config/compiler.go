@@ -31,8 +31,9 @@ import (
 )
 
 type Compiler struct {
-	name    string `yaml:"-"`
-	project string `yaml:"-"`
+	name    string   `yaml:"-"`
+	project string   `yaml:"-"`
+	call    []string `yaml:"-"`
 
 	Call        string            `yaml:"call"`
 	Environment map[string]string `yaml:"environment"`
@@ -50,7 +51,10 @@ func (compiler *Compiler) GetEnvironment() []string {
 }
 
 func (compiler *Compiler) GetArgs() []string {
-	arguments := strings.Split(compiler.Call, " ")
+	arguments := append([]string{}, compiler.call...)
+	if len(arguments) == 0 {
+		arguments = strings.Split(compiler.Call, " ")
+	}
 
 	for _, argument := range compiler.Arguments {
 		if argument.Value == "" {
@@ -89,9 +93,7 @@ func (compiler *Compiler) Compile(ctx context.Context, writer io.Writer, target
 	return nil
 }
 
-func (compiler *Compiler) compile(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, target string) error {
-	ctx, cancel := context.WithCancel(ctx)
-
+func (compiler *Compiler) command(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, target string) *exec.Cmd {
 	args := compiler.GetArgs()
 
 	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
@@ -102,6 +104,14 @@ func (compiler *Compiler) compile(ctx context.Context, stdin io.Reader, stdout,
 	cmd.Stderr = stderr
 	cmd.Stdout = stdout
 
+	return cmd
+}
+
+func (compiler *Compiler) compile(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, target string) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	cmd := compiler.command(ctx, stdin, stdout, stderr, target)
+
 	if err := cmd.Start(); err != nil {
 		cancel()
 		return err
@@ -72,8 +72,11 @@ type Config struct {
 	Packages  map[string]*Package  `yaml:"packages"`
 	Runners   map[string]*Runner   `yaml:"runners"`
 
+	Topologies map[string]*Topology `yaml:"topology"`
+
 	DefaultPackage string `yaml:"default_package"`
 	UseKernel      string `yaml:"use_kernel"`
+	KeepBuilds     int    `yaml:"keep_builds"`
 }
 
 func (config *Config) Sync() error {
@@ -145,6 +148,32 @@ func (config *Config) Kernel(name string) *Kernel {
 	kernel.name = name
 	kernel.compiler = config.Compiler(kernel.Compiler)
 	kernel.Path = util.WDKernel(config.Project, kernel.Name())
+	kernel.required = make(map[string]string)
+
+	if kernel.UKI != nil {
+		kernel.required["CONFIG_EFI"] = "y"
+		kernel.required["CONFIG_EFI_STUB"] = "y"
+	}
+
+	for _, runner := range config.Runners {
+		if runner.Kernel != name && (runner.Kernel != "" || config.UseKernel != name) {
+			continue
+		}
+
+		for option, value := range runner.KernelOptions() {
+			kernel.required[option] = value
+		}
+	}
+
+	for _, pkg := range config.Packages {
+		if pkg.IsModule() && (pkg.Kernel == name || pkg.Kernel == "" && config.UseKernel == name) {
+			kernel.required["CONFIG_MODULES"] = "y"
+		}
+	}
+
+	for option, value := range config.topologyKernelOptions(name) {
+		kernel.required[option] = value
+	}
 
 	return kernel
 }
@@ -158,6 +187,15 @@ func (config *Config) Package(name string) *Package {
 	pkg.name = name
 	pkg.compiler = config.Compiler(pkg.Compiler)
 
+	if pkg.IsModule() {
+		kernel := pkg.Kernel
+		if kernel == "" {
+			kernel = config.UseKernel
+		}
+
+		pkg.kernel = config.Kernel(kernel)
+	}
+
 	if pkg.Target != "" && pkg.Path == "" {
 		pkg.Path = util.WD(pkg.Target)
 		pkg.Target = ""
@@ -175,6 +213,13 @@ func (config *Config) Runner(name string) *Runner {
 	runner.name = name
 	runner.project = config.Project
 
+	kernel := runner.Kernel
+	if kernel == "" {
+		kernel = config.UseKernel
+	}
+
+	runner.kernel = config.Kernel(kernel)
+
 	return runner
 }
 
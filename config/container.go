@@ -0,0 +1,149 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+func (runner *Runner) rootfs() (string, error) {
+	root := runner.Initramfs
+	if root == "" {
+		root = util.WDInitramfs(runner.project)
+	}
+
+	kind := runner.GetKind()
+
+	stat, err := os.Stat(root)
+	if err != nil {
+		return "", err
+	}
+
+	if !stat.IsDir() {
+		return "", errors.New("runner kind " + kind.String() + " requires an initramfs directory")
+	}
+
+	if !util.Exists(path.Join(root, "init")) {
+		return "", errors.New("initramfs " + root + " has no /init")
+	}
+
+	return root, nil
+}
+
+// initrdInit reports whether init is built with golinux, only its initrd
+// binds the host devices and enters root before running anything.
+func initrdInit(init string) bool {
+	info, err := buildinfo.ReadFile(init)
+	if err != nil {
+		return false
+	}
+
+	if info.Main.Path == goLinuxModule {
+		return true
+	}
+
+	for _, dependency := range info.Deps {
+		if dependency.Path == goLinuxModule {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (runner *Runner) container(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	root, err := runner.rootfs()
+	if err != nil {
+		return err
+	}
+
+	if root, err = filepath.Abs(root); err != nil {
+		return err
+	}
+
+	kind := runner.GetKind()
+
+	if init := path.Join(root, "init"); !initrdInit(init) {
+		return errors.New("runner kind " + kind.String() + " requires " + init + " to be a golinux initrd, any other init would run against the host root")
+	}
+
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID)
+	cmdline := runner.Cmdline
+
+	switch kind {
+	case RunnerKindContainer:
+		flags |= syscall.CLONE_NEWNET | syscall.CLONE_NEWUTS
+		cmdline = MergeCmdline(cmdline, []string{"golinux.net=lo"})
+	case RunnerKindChroot:
+		// a chroot shares the host network, there is nothing to configure.
+		for _, parameter := range cmdline {
+			if key, _, _ := strings.Cut(parameter, "="); key == "golinux.net" {
+				return errors.New("runner kind chroot shares the host network and does not support golinux.net")
+			}
+		}
+	}
+
+	// /init enters root itself once the host devices are bound into its /dev.
+	environment := []string{
+		"container=golinux",
+		"GOLINUX_ROOT=" + root,
+		"GOLINUX_CMDLINE=" + strings.Join(cmdline, " "),
+		"PATH=/bin:/sbin:/usr/bin:/usr/sbin",
+		"HOME=/",
+	}
+
+	for k, v := range runner.Environment {
+		environment = append(environment, k+"="+v)
+	}
+
+	cmd := exec.CommandContext(ctx, path.Join(root, "init"))
+
+	cmd.Env = environment
+	cmd.Dir = root
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:                 flags,
+		Pdeathsig:                  syscall.SIGKILL,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+	}
+
+	err = cmd.Run()
+
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) && exitError.ExitCode() > 0 {
+		return &ExitError{Code: exitError.ExitCode(), Err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,45 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"github.com/Dviih/golinux/crash"
+	"github.com/Dviih/golinux/util"
+	"path"
+)
+
+func (kernel *Kernel) Vmlinux() string {
+	return path.Join(kernel.Path, "vmlinux")
+}
+
+func (runner *Runner) Symbolize(ctx context.Context, reports []*crash.Report) error {
+	kernel := runner.GetKernel()
+	if kernel.Path == "" || len(reports) == 0 {
+		return nil
+	}
+
+	modules := util.WDModules(runner.project, kernel.Name())
+	if !util.Exists(modules) {
+		modules = ""
+	}
+
+	return crash.NewSymbolizer(kernel.Vmlinux(), kernel.Path, modules).Symbolize(ctx, reports...)
+}
@@ -0,0 +1,205 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Dviih/golinux/util"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const DefaultGDBPort = 1234
+
+var DebugKernelOptions = map[string]string{
+	"CONFIG_DEBUG_KERNEL":                       "y",
+	"CONFIG_DEBUG_INFO_DWARF_TOOLCHAIN_DEFAULT": "y",
+	"CONFIG_DEBUG_INFO":                         "y",
+	"CONFIG_DEBUG_INFO_REDUCED":                 "n",
+	"CONFIG_GDB_SCRIPTS":                        "y",
+	"CONFIG_RANDOMIZE_BASE":                     "n",
+}
+
+type runnerDebug struct {
+	port int
+}
+
+func (kernel *Kernel) Options() (map[string]string, error) {
+	file, err := os.Open(path.Join(kernel.Path, ".config"))
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	options := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "# CONFIG_") && strings.HasSuffix(line, " is not set") {
+			options[strings.TrimSuffix(strings.TrimPrefix(line, "# "), " is not set")] = "n"
+			continue
+		}
+
+		if option, value, ok := strings.Cut(line, "="); ok && strings.HasPrefix(option, "CONFIG_") {
+			options[option] = strings.Trim(value, `"`)
+		}
+	}
+
+	return options, scanner.Err()
+}
+
+func (kernel *Kernel) EnsureOptions(ctx context.Context, required map[string]string) (bool, error) {
+	options, err := kernel.Options()
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+
+	for option, value := range required {
+		current, ok := options[option]
+		if !ok {
+			current = "n"
+		}
+
+		if value == "" {
+			value = "y"
+		}
+
+		if current == value {
+			continue
+		}
+
+		var cmd *exec.Cmd
+
+		switch value {
+		case "y":
+			cmd = exec.CommandContext(ctx, "./scripts/config", "--enable", option)
+		case "n":
+			cmd = exec.CommandContext(ctx, "./scripts/config", "--disable", option)
+		case "m":
+			cmd = exec.CommandContext(ctx, "./scripts/config", "--module", option)
+		default:
+			cmd = exec.CommandContext(ctx, "./scripts/config", "--set-str", option, value)
+		}
+
+		cmd.Dir = kernel.Path
+
+		if err = cmd.Run(); err != nil {
+			return changed, err
+		}
+
+		changed = true
+	}
+
+	return changed, nil
+}
+
+func (runner *Runner) Debug(port int) (*Runner, error) {
+	switch kind := runner.GetKind(); kind {
+	case RunnerKindQEMU, RunnerKindKVM:
+	default:
+		return nil, errors.New("runner kind " + kind.String() + " does not support debugging")
+	}
+
+	if runner.GetKernel().compiler == nil {
+		return nil, errors.New("runner " + runner.Name() + " has no kernel to debug")
+	}
+
+	if port == 0 {
+		port = DefaultGDBPort
+	}
+
+	debug := *runner
+	debug.debug = &runnerDebug{port: port}
+
+	return &debug, nil
+}
+
+// debugArguments keeps nokaslr on the cmdline for kernels built before
+// CONFIG_RANDOMIZE_BASE was disabled, a boot image also needs the latter.
+func (runner *Runner) debugArguments() (KVS, []string) {
+	if runner.debug == nil {
+		return nil, nil
+	}
+
+	return KVS{
+		{Key: "gdb", Value: "tcp::" + strconv.Itoa(runner.debug.port)},
+		{Key: "S"},
+	}, []string{"nokaslr"}
+}
+
+func (runner *Runner) GDBInit() string {
+	return util.WDInstance(runner.project, runner.Instance(), "gdbinit")
+}
+
+func (runner *Runner) WriteGDBInit() (string, error) {
+	port := DefaultGDBPort
+	if runner.debug != nil {
+		port = runner.debug.port
+	}
+
+	kernel := runner.GetKernel().Path
+
+	initramfs := runner.Initramfs
+	if initramfs == "" {
+		initramfs = util.WDInitramfs(runner.project)
+	}
+
+	var builder strings.Builder
+
+	fmt.Fprintln(&builder, "set pagination off")
+	fmt.Fprintln(&builder, "set confirm off")
+	fmt.Fprintf(&builder, "add-auto-load-safe-path %s\n", kernel)
+	fmt.Fprintf(&builder, "file %s\n", path.Join(kernel, "vmlinux"))
+
+	if scripts := path.Join(kernel, "vmlinux-gdb.py"); util.Exists(scripts) {
+		fmt.Fprintf(&builder, "source %s\n", scripts)
+	}
+
+	if init := path.Join(initramfs, "init"); util.Exists(init) {
+		fmt.Fprintf(&builder, "add-symbol-file %s\n", init)
+
+		if goroot, err := exec.Command("go", "env", "GOROOT").Output(); err == nil {
+			if runtimeGDB := path.Join(strings.TrimSpace(string(goroot)), "src", "runtime", "runtime-gdb.py"); util.Exists(runtimeGDB) {
+				fmt.Fprintf(&builder, "source %s\n", runtimeGDB)
+			}
+		}
+	}
+
+	fmt.Fprintf(&builder, "target remote :%d\n", port)
+
+	name := runner.GDBInit()
+
+	if err := os.MkdirAll(path.Dir(name), 0750); err != nil {
+		return "", err
+	}
+
+	return name, os.WriteFile(name, []byte(builder.String()), 0644)
+}
@@ -0,0 +1,254 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	DiskInterfaceVirtio = "virtio"
+	DiskInterfaceNVMe   = "nvme"
+	DiskInterfaceSCSI   = "scsi"
+)
+
+type Disk struct {
+	Path       string `yaml:"path"`
+	Format     string `yaml:"format"`
+	Interface  string `yaml:"interface"`
+	Snapshot   *bool  `yaml:"snapshot"`
+	ReadOnly   bool   `yaml:"readonly"`
+	Size       string `yaml:"size"`
+	Filesystem string `yaml:"filesystem"`
+	Source     string `yaml:"source"`
+}
+
+func (disk *Disk) GetPath() string {
+	if disk.Path == "" || disk.Path[0] == '/' {
+		return disk.Path
+	}
+
+	return util.WD(disk.Path)
+}
+
+func (disk *Disk) GetFormat() string {
+	if disk.Format != "" {
+		return strings.ToLower(disk.Format)
+	}
+
+	if path.Ext(disk.Path) == ".qcow2" {
+		return "qcow2"
+	}
+
+	return "raw"
+}
+
+func (disk *Disk) GetInterface() string {
+	if disk.Interface == "" {
+		return DiskInterfaceVirtio
+	}
+
+	return strings.ToLower(disk.Interface)
+}
+
+func (disk *Disk) GetSnapshot() bool {
+	return disk.Snapshot == nil || *disk.Snapshot
+}
+
+func run(ctx context.Context, name string, args ...string) error {
+	stderr := &util.Writer{}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = stderr
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return stderr.Error(err)
+	}
+
+	return nil
+}
+
+func (disk *Disk) Create(ctx context.Context) error {
+	if disk.Size == "" {
+		return errors.New("disk requires a size to be created")
+	}
+
+	size, err := util.ParseSize(disk.Size)
+	if err != nil {
+		return err
+	}
+
+	target := disk.GetPath()
+	raw := target
+
+	if disk.GetFormat() == "qcow2" {
+		if disk.Filesystem == "" {
+			return run(ctx, "qemu-img", "create", "-f", "qcow2", target, strconv.FormatInt(size, 10))
+		}
+
+		raw = target + ".raw"
+		defer os.Remove(raw)
+	}
+
+	if err = os.MkdirAll(path.Dir(raw), 0750); err != nil {
+		return err
+	}
+
+	file, err := os.Create(raw)
+	if err != nil {
+		return err
+	}
+
+	if err = file.Truncate(size); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	source := disk.Source
+	if source != "" && source[0] != '/' {
+		source = util.WD(source)
+	}
+
+	switch strings.ToLower(disk.Filesystem) {
+	case "":
+	case "ext2", "ext3", "ext4":
+		args := []string{"-q", "-F", "-t", strings.ToLower(disk.Filesystem)}
+		if source != "" {
+			args = append(args, "-d", source)
+		}
+
+		if err = run(ctx, "mke2fs", append(args, raw)...); err != nil {
+			return err
+		}
+	case "vfat", "fat":
+		if err = run(ctx, "mkfs.vfat", raw); err != nil {
+			return err
+		}
+
+		if source != "" {
+			entries, err := os.ReadDir(source)
+			if err != nil {
+				return err
+			}
+
+			args := []string{"-s", "-i", raw}
+
+			for _, entry := range entries {
+				args = append(args, path.Join(source, entry.Name()))
+			}
+
+			if len(entries) > 0 {
+				if err = run(ctx, "mcopy", append(args, "::/")...); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return errors.New("unsupported filesystem: " + disk.Filesystem)
+	}
+
+	if raw != target {
+		return run(ctx, "qemu-img", "convert", "-f", "raw", "-O", "qcow2", raw, target)
+	}
+
+	return nil
+}
+
+func qemuEscape(s string) string {
+	return strings.ReplaceAll(s, ",", ",,")
+}
+
+func (runner *Runner) disks(ctx context.Context) (KVS, error) {
+	var (
+		arguments KVS
+		scsi      bool
+	)
+
+	for i, disk := range runner.Disks {
+		if disk.Path == "" {
+			return nil, errors.New("disk requires a path")
+		}
+
+		if !util.Exists(disk.GetPath()) {
+			if err := disk.Create(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		id := "disk" + strconv.Itoa(i)
+		drive := "file=" + qemuEscape(disk.GetPath()) + ",format=" + disk.GetFormat() + ",if=none,id=" + id
+
+		if disk.GetSnapshot() {
+			drive += ",snapshot=on"
+		}
+
+		if disk.ReadOnly {
+			drive += ",readonly=on"
+		}
+
+		arguments = append(arguments, &KV{Key: "drive", Value: drive})
+
+		switch disk.GetInterface() {
+		case DiskInterfaceVirtio:
+			arguments = append(arguments, &KV{Key: "device", Value: "virtio-blk-pci,drive=" + id})
+		case DiskInterfaceNVMe:
+			arguments = append(arguments, &KV{Key: "device", Value: "nvme,serial=" + id + ",drive=" + id})
+		case DiskInterfaceSCSI:
+			if !scsi {
+				scsi = true
+				arguments = append(arguments, &KV{Key: "device", Value: "virtio-scsi-pci,id=scsi0"})
+			}
+
+			arguments = append(arguments, &KV{Key: "device", Value: "scsi-hd,drive=" + id + ",bus=scsi0.0"})
+		default:
+			return nil, errors.New("invalid disk interface: " + disk.Interface)
+		}
+	}
+
+	return arguments, nil
+}
+
+// CreateDisks creates missing disk images, existing ones are only recreated
+// with force as that discards their contents.
+func (runner *Runner) CreateDisks(ctx context.Context, force bool) error {
+	for _, disk := range runner.Disks {
+		if disk.Size == "" || (!force && util.Exists(disk.GetPath())) {
+			continue
+		}
+
+		if err := disk.Create(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"debug/pe"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportFormatDisk = "disk"
+	ExportFormatISO  = "iso"
+	ExportFormatUKI  = "uki"
+)
+
+var exportExtensions = map[string]string{
+	ExportFormatDisk: ".img",
+	ExportFormatISO:  ".iso",
+	ExportFormatUKI:  ".efi",
+}
+
+func (runner *Runner) ExportPath(format string) string {
+	return util.WDProject(runner.project, "export", runner.Name()+exportExtensions[format])
+}
+
+func (runner *Runner) Export(ctx context.Context, format, output string) (string, error) {
+	format = strings.ToLower(format)
+
+	if _, ok := exportExtensions[format]; !ok {
+		return "", errors.New("invalid export format: " + format)
+	}
+
+	kernel := runner.GetKernel()
+	if kernel.Path == "" {
+		return "", errors.New("runner " + runner.Name() + " has no kernel to export")
+	}
+
+	if output == "" {
+		output = runner.ExportPath(format)
+	}
+
+	if err := os.MkdirAll(path.Dir(output), 0750); err != nil {
+		return "", err
+	}
+
+	image, err := runner.Image()
+	if err != nil {
+		return "", err
+	}
+
+	if err = efiImage(image); err != nil {
+		return "", err
+	}
+
+	initramfs, err := runner.InitramfsArchive()
+	if err != nil {
+		return "", err
+	}
+
+	if format == ExportFormatUKI {
+		return output, kernel.uki(ctx, runner.GetArch(), image, initramfs, runner.BootCmdline(), output)
+	}
+
+	staging := util.WDProject(runner.project, "export", runner.Name())
+
+	if err = os.RemoveAll(staging); err != nil {
+		return "", err
+	}
+
+	defer os.RemoveAll(staging)
+
+	esp, err := runner.esp(ctx, staging, image, initramfs)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case ExportFormatDisk:
+		return output, writeDisk(output, esp)
+	default:
+		root := path.Join(staging, "iso")
+
+		if err = os.MkdirAll(path.Join(root, "boot"), 0750); err != nil {
+			return "", err
+		}
+
+		if err = os.Rename(esp, path.Join(root, "boot", "efiboot.img")); err != nil {
+			return "", err
+		}
+
+		return output, run(ctx, "xorriso", "-as", "mkisofs",
+			"-o", output,
+			"-R", "-J",
+			"-V", "GOLINUX",
+			"-e", "boot/efiboot.img",
+			"-no-emul-boot",
+			"-isohybrid-gpt-basdat",
+			root,
+		)
+	}
+}
+
+func (runner *Runner) esp(ctx context.Context, staging, image, initramfs string) (string, error) {
+	arch, err := runner.arch()
+	if err != nil {
+		return "", err
+	}
+
+	if arch.EFI == "" {
+		return "", errors.New("arch " + runner.GetArch() + " has no efi boot path")
+	}
+
+	root := path.Join(staging, "esp")
+	boot := path.Join(root, "EFI", "BOOT", arch.EFI)
+
+	// the firmware starts the removable media path directly, so the initramfs
+	// and cmdline have to travel inside a unified kernel image.
+	if err = runner.GetKernel().uki(ctx, runner.GetArch(), image, initramfs, runner.BootCmdline(), boot); err != nil {
+		return "", err
+	}
+
+	stat, err := os.Stat(boot)
+	if err != nil {
+		return "", err
+	}
+
+	size := max(64<<20, (stat.Size()+stat.Size()/4+(8<<20))&^((1<<20)-1))
+
+	disk := &Disk{
+		Path:       path.Join(staging, "esp.img"),
+		Format:     "raw",
+		Size:       strconv.FormatInt(size, 10),
+		Filesystem: "vfat",
+		Source:     root,
+	}
+
+	if err = disk.Create(ctx); err != nil {
+		return "", err
+	}
+
+	return disk.Path, nil
+}
+
+func efiImage(image string) error {
+	file, err := pe.Open(image)
+	if err != nil {
+		return errors.New("kernel image " + image + " is not an efi application, export requires CONFIG_EFI_STUB")
+	}
+
+	return file.Close()
+}
+
+func writeDisk(output, esp string) error {
+	src, err := os.Open(esp)
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	sectors := uint64(stat.Size() / util.SectorSize)
+	size := int64(util.GPTFirstLBA*2+sectors) * util.SectorSize
+
+	dst, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	if err = dst.Truncate(size); err != nil {
+		dst.Close()
+		return err
+	}
+
+	espType, err := util.ParseGUID(util.GPTTypeESP)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	guid, err := util.NewGUID()
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	partition := &util.GPTPartition{
+		Type:  espType,
+		GUID:  guid,
+		First: util.GPTFirstLBA,
+		Last:  util.GPTFirstLBA + sectors - 1,
+		Name:  "EFI System Partition",
+	}
+
+	if err = util.WriteGPT(dst, size, []*util.GPTPartition{partition}); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if _, err = dst.Seek(util.GPTFirstLBA*util.SectorSize, io.SeekStart); err != nil {
+		dst.Close()
+		return err
+	}
+
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
@@ -0,0 +1,273 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	goTestBegin = "GOLINUX-GOTEST-BEGIN"
+	goTestEnd   = "GOLINUX-GOTEST-END"
+
+	goLinuxModule = "github.com/Dviih/golinux"
+)
+
+//go:embed gotest/main.go
+var goTestInit []byte
+
+type TestEvent struct {
+	Time    time.Time `json:"Time"`
+	Action  string    `json:"Action"`
+	Package string    `json:"Package"`
+	Test    string    `json:"Test"`
+	Elapsed float64   `json:"Elapsed"`
+	Output  string    `json:"Output"`
+}
+
+type goTestWriter struct {
+	m      sync.Mutex
+	line   []byte
+	state  int
+	code   int
+	stdin  io.Writer
+	output io.Writer
+}
+
+func (writer *goTestWriter) Write(data []byte) (int, error) {
+	defer writer.m.Unlock()
+	writer.m.Lock()
+
+	for _, b := range data {
+		if b != '\n' {
+			writer.line = append(writer.line, b)
+			continue
+		}
+
+		line := strings.TrimRight(string(writer.line), "\r")
+		writer.line = writer.line[:0]
+
+		switch {
+		case writer.state == 0 && strings.HasSuffix(line, goTestBegin):
+			writer.state = 1
+		case writer.state == 1 && strings.HasPrefix(line, goTestEnd):
+			code, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, goTestEnd)))
+			if err != nil {
+				code = 1
+			}
+
+			writer.code = code
+			writer.state = 2
+		case writer.state == 1:
+			if _, err := io.WriteString(writer.stdin, line+"\n"); err != nil {
+				return 0, err
+			}
+		default:
+			if writer.output != nil {
+				if _, err := io.WriteString(writer.output, line+"\n"); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	return len(data), nil
+}
+
+func (runner *Runner) goEnvironment() []string {
+	return append(os.Environ(), "GOOS=linux", "GOARCH="+runner.GetArch(), "CGO_ENABLED=0")
+}
+
+func (runner *Runner) goBuild(ctx context.Context, dir string, args ...string) error {
+	stderr := &util.Writer{}
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = runner.goEnvironment()
+	cmd.Stdout = stderr
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return stderr.Error(err)
+	}
+
+	return nil
+}
+
+// goTestModule requires golinux for the guest init, from the tested module when
+// it depends on golinux and from the version of this binary otherwise.
+func goTestModule(ctx context.Context) (string, error) {
+	module := "module golinux/gotest\n\ngo 1.24\n\nrequire " + goLinuxModule + " "
+
+	cmd := exec.CommandContext(ctx, "go", "list", "-m", "-f", "{{.Dir}}", goLinuxModule)
+	cmd.Dir = util.WD()
+
+	if output, err := cmd.Output(); err == nil && len(bytes.TrimSpace(output)) > 0 {
+		return module + "v0.0.0\n\nreplace " + goLinuxModule + " => " + string(bytes.TrimSpace(output)) + "\n", nil
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		modules := append([]*debug.Module{&info.Main}, info.Deps...)
+
+		for _, m := range modules {
+			if m.Path == goLinuxModule && m.Version != "" && m.Version != "(devel)" {
+				return module + m.Version + "\n", nil
+			}
+		}
+	}
+
+	return "", errors.New("gotest requires " + goLinuxModule + " as a dependency of the tested module or a released golinux build")
+}
+
+func (runner *Runner) goTestStage(ctx context.Context, pkg string, args []string) (string, error) {
+	stage := util.WDProject(runner.project, "gotest", runner.name)
+	initramfs := path.Join(stage, "initramfs")
+	source := path.Join(stage, "source")
+
+	if err := os.RemoveAll(stage); err != nil {
+		return "", err
+	}
+
+	for _, dir := range []string{initramfs, source} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return "", err
+		}
+	}
+
+	if err := runner.goBuild(ctx, util.WD(), "test", "-c", "-o", path.Join(initramfs, "golinux.test"), pkg); err != nil {
+		return "", err
+	}
+
+	module, err := goTestModule(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.WriteFile(path.Join(source, "go.mod"), []byte(module), 0644); err != nil {
+		return "", err
+	}
+
+	// the build constraint only keeps the guest init out of this module.
+	if err = os.WriteFile(path.Join(source, "main.go"), bytes.TrimPrefix(goTestInit, []byte("//go:build ignore\n")), 0644); err != nil {
+		return "", err
+	}
+
+	if err = runner.goBuild(ctx, source, "mod", "tidy"); err != nil {
+		return "", err
+	}
+
+	if err = runner.goBuild(ctx, source, "build", "-o", path.Join(initramfs, "init"), "."); err != nil {
+		return "", err
+	}
+
+	if err = os.WriteFile(path.Join(initramfs, "golinux.args"), []byte(strings.Join(args, "\n")), 0644); err != nil {
+		return "", err
+	}
+
+	return initramfs, nil
+}
+
+func (runner *Runner) GoTest(ctx context.Context, pkg string, args []string, output io.Writer, events func(*TestEvent)) (int, error) {
+	initramfs, err := runner.goTestStage(ctx, pkg, args)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	test2json := exec.CommandContext(ctx, "go", "tool", "test2json", "-t", "-p", pkg)
+
+	stdin, err := test2json.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+
+	stdout, err := test2json.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+
+	if err = test2json.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+
+		for scanner.Scan() {
+			event := &TestEvent{}
+
+			if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+				continue
+			}
+
+			if events != nil {
+				events(event)
+			}
+		}
+
+		done <- scanner.Err()
+	}()
+
+	writer := &goTestWriter{stdin: stdin, output: output}
+
+	guest := *runner
+	guest.Initramfs = initramfs
+	guest.Graphic = false
+	guest.Cmdline = append(append([]string{}, runner.Cmdline...), "quiet", "loglevel=0", "panic=-1")
+
+	err = guest.Execute(ctx, nil, writer, writer)
+
+	if closeErr := stdin.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+
+	if scanErr := <-done; scanErr != nil && err == nil {
+		err = scanErr
+	}
+
+	if waitErr := test2json.Wait(); waitErr != nil && err == nil {
+		err = waitErr
+	}
+
+	if writer.state != 2 {
+		return 0, errors.Join(errors.New("guest did not report a test result"), err)
+	}
+
+	return writer.code, nil
+}
@@ -0,0 +1,94 @@
+//go:build ignore
+
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Dviih/golinux/initrd"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	begin = "GOLINUX-GOTEST-BEGIN"
+	end   = "GOLINUX-GOTEST-END"
+)
+
+var bpf = &initrd.Mount{Source: "bpf", Target: "/sys/fs/bpf", Type: "bpf", Flags: unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC}
+
+func arguments() []string {
+	args := []string{"-test.v=test2json"}
+
+	file, err := os.Open("/golinux.args")
+	if err != nil {
+		return args
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			args = append(args, line)
+		}
+	}
+
+	return args
+}
+
+func test(ctx context.Context) error {
+	_ = bpf.Mount()
+
+	fmt.Println(begin)
+
+	cmd := exec.CommandContext(ctx, "/golinux.test", arguments()...)
+	cmd.Dir = "/"
+	cmd.Env = append(os.Environ(), "TMPDIR=/tmp")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stdout
+
+	code := 0
+
+	if err := cmd.Run(); err != nil {
+		var exitError *exec.ExitError
+
+		if errors.As(err, &exitError) {
+			code = exitError.ExitCode()
+		} else {
+			fmt.Println(err)
+			code = 1
+		}
+	}
+
+	fmt.Println(end, code)
+	return nil
+}
+
+func main() {
+	initrd.Run(test)
+}
@@ -0,0 +1,346 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"errors"
+	"github.com/Dviih/golinux/qmp"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const DefaultDownTimeout = 30 * time.Second
+
+const (
+	InstanceStateStopped = "stopped"
+	InstanceStateRunning = "running"
+)
+
+type Instance struct {
+	name    string
+	project string
+}
+
+func (config *Config) Instance(name string) *Instance {
+	return &Instance{name: name, project: config.Project}
+}
+
+func (config *Config) Instances() ([]*Instance, error) {
+	entries, err := os.ReadDir(util.WDProject(config.Project, "instances"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var instances []*Instance
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			instances = append(instances, config.Instance(entry.Name()))
+		}
+	}
+
+	return instances, nil
+}
+
+func (instance *Instance) Name() string {
+	return instance.name
+}
+
+func (instance *Instance) Path(paths ...interface{}) string {
+	return util.WDInstance(instance.project, instance.name, paths...)
+}
+
+func (instance *Instance) Log() string {
+	return instance.Path("console.log")
+}
+
+func (instance *Instance) Pid() (int, error) {
+	data, err := os.ReadFile(instance.Path("pid"))
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func (instance *Instance) Alive() bool {
+	pid, err := instance.Pid()
+	if err != nil || pid <= 0 {
+		return false
+	}
+
+	err = syscall.Kill(pid, 0)
+	return (err == nil || errors.Is(err, syscall.EPERM)) && instance.owns(pid)
+}
+
+// owns reports whether pid was started for this instance, a stale pid file can
+// name a pid the kernel has since given to an unrelated process.
+func (instance *Instance) owns(pid int) bool {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil {
+		return false
+	}
+
+	dir := instance.Path() + "/"
+
+	for _, argument := range strings.Split(string(data), "\x00") {
+		if strings.Contains(argument, dir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (instance *Instance) Uptime() time.Duration {
+	stat, err := os.Stat(instance.Path("pid"))
+	if err != nil || !instance.Alive() {
+		return 0
+	}
+
+	return time.Since(stat.ModTime())
+}
+
+func (instance *Instance) QMP(ctx context.Context) (*qmp.Client, error) {
+	return qmp.Dial(ctx, instance.Path("qmp.sock"))
+}
+
+func (instance *Instance) State(ctx context.Context) string {
+	if !instance.Alive() {
+		return InstanceStateStopped
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	client, err := instance.QMP(ctx)
+	if err != nil {
+		return InstanceStateRunning
+	}
+
+	defer client.Close()
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return InstanceStateRunning
+	}
+
+	return status.Status
+}
+
+func (instance *Instance) Console(ctx context.Context, stdin io.Reader, stdout io.Writer) error {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "unix", instance.Path("console.sock"))
+	if err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+
+	defer stop()
+
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(conn, stdin)
+		}()
+	}
+
+	_, err = io.Copy(stdout, conn)
+
+	if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
+
+func (instance *Instance) Down(ctx context.Context, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = DefaultDownTimeout
+	}
+
+	if instance.Alive() {
+		if client, err := instance.QMP(ctx); err == nil {
+			_ = client.SystemPowerdown(ctx)
+			client.Close()
+		}
+
+		deadline := time.NewTimer(timeout)
+		defer deadline.Stop()
+
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+	wait:
+		for instance.Alive() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-deadline.C:
+				break wait
+			case <-ticker.C:
+			}
+		}
+
+		// Alive checks that the pid still belongs to the instance before it is killed.
+		if instance.Alive() {
+			pid, err := instance.Pid()
+			if err != nil {
+				return err
+			}
+
+			if err = syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+				return err
+			}
+		}
+	}
+
+	if err := instance.stopHelpers(); err != nil {
+		return err
+	}
+
+	for _, name := range []string{"pid", "qmp.sock", "console.sock", "helpers"} {
+		if err := os.Remove(instance.Path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (runner *Runner) Up(ctx context.Context, name string) (*Instance, error) {
+	switch kind := runner.GetKind(); kind {
+	case RunnerKindQEMU, RunnerKindKVM:
+	default:
+		return nil, errors.New("runner kind " + kind.String() + " does not support instances")
+	}
+
+	detached := *runner
+	detached.detached = true
+
+	if name != "" {
+		detached.instance = name
+	}
+
+	instance := &Instance{name: detached.Instance(), project: runner.project}
+
+	if instance.Alive() {
+		return nil, errors.New("instance " + instance.Name() + " is already running")
+	}
+
+	if err := os.MkdirAll(instance.Path(), 0750); err != nil {
+		return nil, err
+	}
+
+	if err := instance.stopHelpers(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{"pid", "qmp.sock", "console.sock", "helpers"} {
+		if err := os.Remove(instance.Path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	compiler, cleanup, err := detached.qemu(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stderr := &util.Writer{}
+
+	if err = compiler.compile(ctx, nil, stderr, stderr, util.WDProject(runner.project)); err != nil {
+		cleanup()
+		return nil, stderr.Error(err)
+	}
+
+	if !instance.Alive() {
+		cleanup()
+		return nil, errors.New("instance " + instance.Name() + " did not start")
+	}
+
+	var helpers []string
+
+	for _, helper := range detached.helpers {
+		helpers = append(helpers, strconv.Itoa(helper.Process.Pid))
+		_ = helper.Process.Release()
+	}
+
+	if err = os.WriteFile(instance.Path("helpers"), []byte(strings.Join(helpers, "\n")), 0644); err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+func (instance *Instance) stopHelpers() error {
+	data, err := os.ReadFile(instance.Path("helpers"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil || pid <= 0 || !instance.owns(pid) {
+			continue
+		}
+
+		if err = syscall.Kill(pid, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (runner *Runner) detachArguments() KVS {
+	if !runner.detached {
+		return nil
+	}
+
+	dir := util.WDInstance(runner.project, runner.Instance())
+
+	return KVS{
+		{Key: "display", Value: "none"},
+		{Key: "monitor", Value: "none"},
+		{Key: "chardev", Value: "socket,id=console,path=" + qemuEscape(path.Join(dir, "console.sock")) + ",server=on,wait=off,logfile=" + qemuEscape(path.Join(dir, "console.log"))},
+		{Key: "serial", Value: "chardev:console"},
+		{Key: "qmp", Value: "unix:" + qemuEscape(path.Join(dir, "qmp.sock")) + ",server=on,wait=off"},
+		{Key: "pidfile", Value: path.Join(dir, "pid")},
+		{Key: "daemonize"},
+	}
+}
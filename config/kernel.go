@@ -21,19 +21,34 @@ package config
 
 import (
 	"context"
+	"errors"
 	"github.com/Dviih/golinux/util"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"path"
+	"strings"
 )
 
 type Kernel struct {
-	name     string    `yaml:"-"`
-	compiler *Compiler `yaml:"-"`
+	name     string            `yaml:"-"`
+	compiler *Compiler         `yaml:"-"`
+	required map[string]string `yaml:"-"`
 
 	Path     string `yaml:"path"`
 	Config   string `yaml:"config"`
 	Compiler string `yaml:"compiler"`
+
+	ModulesInstall bool     `yaml:"modules_install"`
+	KeepVmlinux    bool     `yaml:"keep_vmlinux"`
+	Modules        []string `yaml:"modules"`
+	Cmdline        []string `yaml:"cmdline"`
+
+	// Patches already applied to the tree at Path, they are recorded in the SBOM.
+	Patches []string `yaml:"patches"`
+
+	UKI *KernelUKI `yaml:"uki"`
 }
 
 func (kernel *Kernel) Name() string {
@@ -61,15 +76,33 @@ var configMap = map[string]string{
 }
 
 func (kernel *Kernel) config(ctx context.Context) error {
-	configMap := configMap
+	configMap := maps.Clone(configMap)
 	configMap["CONFIG_INITRAMFS_SOURCE"] = util.WDInitramfs(kernel.compiler.project)
 
+	for option, value := range kernel.required {
+		configMap[option] = value
+	}
+
+	if kernel.ModulesInstall || len(kernel.Modules) > 0 {
+		configMap["CONFIG_MODULES"] = "y"
+	}
+
+	if cmdline := kernel.GetCmdline(); len(cmdline) > 0 {
+		configMap["CONFIG_CMDLINE_BOOL"] = "y"
+		configMap["CONFIG_CMDLINE"] = strings.Join(cmdline, " ")
+	}
+
 	for property, value := range configMap {
 		var cmd *exec.Cmd
 
-		if value == "" {
+		switch value {
+		case "", "y":
 			cmd = exec.CommandContext(ctx, "./scripts/config", "--enable", property)
-		} else {
+		case "n":
+			cmd = exec.CommandContext(ctx, "./scripts/config", "--disable", property)
+		case "m":
+			cmd = exec.CommandContext(ctx, "./scripts/config", "--module", property)
+		default:
 			cmd = exec.CommandContext(ctx, "./scripts/config", "--set-str", property, value)
 		}
 
@@ -84,9 +117,52 @@ func (kernel *Kernel) config(ctx context.Context) error {
 }
 
 func (kernel *Kernel) Build(ctx context.Context, writer io.Writer) error {
+	if kernel.compiler == nil {
+		return errors.New("kernel " + kernel.Name() + " is not defined")
+	}
+
+	if err := kernel.build(ctx, writer); err != nil {
+		return err
+	}
+
+	if kernel.UKI == nil {
+		return nil
+	}
+
+	_, err := kernel.BuildUKI(ctx)
+	return err
+}
+
+func (kernel *Kernel) build(ctx context.Context, writer io.Writer) error {
 	if err := kernel.config(ctx); err != nil {
 		return err
 	}
 
+	if err := kernel.compiler.Compile(ctx, writer, kernel.Path); err != nil {
+		return err
+	}
+
+	if !kernel.ModulesInstall && len(kernel.Modules) == 0 {
+		return nil
+	}
+
+	if err := kernel.modules(ctx, writer); err != nil {
+		return err
+	}
+
+	if len(kernel.Modules) == 0 {
+		return nil
+	}
+
+	// the initramfs is embedded, relink the image so it carries the modules.
 	return kernel.compiler.Compile(ctx, writer, kernel.Path)
 }
+
+func (kernel *Kernel) Release() (string, error) {
+	data, err := os.ReadFile(path.Join(kernel.Path, "include", "config", "kernel.release"))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,375 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// microStatus is printed by initrd when golinux.status is set, neither microVM
+// has an exit device that carries the status of the guest.
+var microStatus = regexp.MustCompile(`^golinux: exit status (\d+)\r?$`)
+
+type statusWriter struct {
+	m      sync.Mutex
+	writer io.Writer
+	line   []byte
+	code   int
+}
+
+func (status *statusWriter) Write(data []byte) (int, error) {
+	status.m.Lock()
+
+	for _, b := range data {
+		if b != '\n' {
+			status.line = append(status.line, b)
+			continue
+		}
+
+		if match := microStatus.FindSubmatch(status.line); match != nil {
+			status.code, _ = strconv.Atoi(string(match[1]))
+		}
+
+		status.line = status.line[:0]
+	}
+
+	status.m.Unlock()
+
+	if status.writer == nil {
+		return len(data), nil
+	}
+
+	return status.writer.Write(data)
+}
+
+func (status *statusWriter) guest(err error) error {
+	status.m.Lock()
+	defer status.m.Unlock()
+
+	if err != nil || status.code == 0 {
+		return err
+	}
+
+	return &ExitError{Code: status.code, Err: errors.New("guest reported exit status " + strconv.Itoa(status.code))}
+}
+
+type microDisk struct {
+	path     string
+	readOnly bool
+}
+
+type firecrackerBootSource struct {
+	KernelImagePath string `json:"kernel_image_path"`
+	InitrdPath      string `json:"initrd_path,omitempty"`
+	BootArgs        string `json:"boot_args"`
+}
+
+type firecrackerDrive struct {
+	DriveID      string `json:"drive_id"`
+	PathOnHost   string `json:"path_on_host"`
+	IsRootDevice bool   `json:"is_root_device"`
+	IsReadOnly   bool   `json:"is_read_only"`
+}
+
+type firecrackerMachine struct {
+	VCPUCount  int   `json:"vcpu_count"`
+	MemSizeMib int64 `json:"mem_size_mib"`
+}
+
+type firecrackerNetwork struct {
+	IfaceID     string `json:"iface_id"`
+	HostDevName string `json:"host_dev_name"`
+	GuestMAC    string `json:"guest_mac,omitempty"`
+}
+
+type firecrackerConfig struct {
+	BootSource        firecrackerBootSource `json:"boot-source"`
+	Drives            []*firecrackerDrive   `json:"drives"`
+	MachineConfig     firecrackerMachine    `json:"machine-config"`
+	NetworkInterfaces []*firecrackerNetwork `json:"network-interfaces,omitempty"`
+}
+
+func (runner *Runner) microImage() (string, error) {
+	kind := runner.GetKind()
+
+	switch arch := runner.GetArch(); arch {
+	case "amd64":
+		return runner.GetKernel().Vmlinux(), nil
+	case "arm64":
+		return runner.Image()
+	default:
+		return "", errors.New("runner kind " + kind.String() + " does not support arch " + arch)
+	}
+}
+
+func (runner *Runner) microCPUs() int {
+	if runner.CPUs > 0 {
+		return runner.CPUs
+	}
+
+	return 1
+}
+
+func (runner *Runner) microValidate() error {
+	kind := runner.GetKind()
+
+	if runner.Vsock != nil {
+		return errors.New("runner kind " + kind.String() + " does not support vsock")
+	}
+
+	if len(runner.Shares) > 0 {
+		return errors.New("runner kind " + kind.String() + " does not support shares")
+	}
+
+	return nil
+}
+
+func (runner *Runner) microNetwork() (string, string, []string, error) {
+	if runner.Network == nil || runner.Network.GetMode() == NetworkModeNone {
+		return "", "", nil, nil
+	}
+
+	if mode := runner.Network.GetMode(); mode != NetworkModeTap {
+		kind := runner.GetKind()
+		return "", "", nil, errors.New("runner kind " + kind.String() + " does not support network mode " + mode)
+	}
+
+	if runner.Network.Tap == "" {
+		return "", "", nil, errors.New("tap network requires a tap interface")
+	}
+
+	return runner.Network.Tap, runner.Network.MAC, []string{runner.Network.cmdline()}, nil
+}
+
+func (runner *Runner) microDisks(ctx context.Context) ([]*microDisk, error) {
+	var disks []*microDisk
+
+	kind := runner.GetKind()
+
+	for i, disk := range runner.Disks {
+		if disk.Path == "" {
+			return nil, errors.New("disk requires a path")
+		}
+
+		if format := disk.GetFormat(); format != "raw" {
+			return nil, errors.New("runner kind " + kind.String() + " does not support disk format " + format)
+		}
+
+		if !util.Exists(disk.GetPath()) {
+			if err := disk.Create(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		name := disk.GetPath()
+
+		if disk.GetSnapshot() && !disk.ReadOnly {
+			name = util.WDProject(runner.project, "runners", runner.Name(), "disks", "disk"+strconv.Itoa(i)+".img")
+
+			if err := os.MkdirAll(path.Dir(name), 0750); err != nil {
+				return nil, err
+			}
+
+			if err := util.CopyFile(name, disk.GetPath()); err != nil {
+				return nil, err
+			}
+		}
+
+		disks = append(disks, &microDisk{path: name, readOnly: disk.ReadOnly})
+	}
+
+	return disks, nil
+}
+
+func (runner *Runner) microCleanup() {
+	_ = os.RemoveAll(util.WDProject(runner.project, "runners", runner.Name(), "disks"))
+}
+
+func (runner *Runner) firecracker(ctx context.Context) (*Compiler, func(), error) {
+	if err := runner.microValidate(); err != nil {
+		return nil, nil, err
+	}
+
+	image, err := runner.microImage()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	initramfs, err := runner.InitramfsArchive()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	memory, err := util.ParseSize(runner.GetMemory())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tap, mac, networkCmdline, err := runner.microNetwork()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	disks, err := runner.microDisks(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &firecrackerConfig{
+		BootSource: firecrackerBootSource{
+			KernelImagePath: image,
+			InitrdPath:      initramfs,
+			BootArgs:        strings.Join(MergeCmdline(runner.GetCmdline(), []string{"console=ttyS0", "reboot=k", "panic=1", "pci=off", "golinux.reboot", "golinux.status"}, networkCmdline), " "),
+		},
+		MachineConfig: firecrackerMachine{
+			VCPUCount:  runner.microCPUs(),
+			MemSizeMib: memory >> 20,
+		},
+	}
+
+	for i, disk := range disks {
+		config.Drives = append(config.Drives, &firecrackerDrive{
+			DriveID:    "disk" + strconv.Itoa(i),
+			PathOnHost: disk.path,
+			IsReadOnly: disk.readOnly,
+		})
+	}
+
+	if tap != "" {
+		config.NetworkInterfaces = append(config.NetworkInterfaces, &firecrackerNetwork{
+			IfaceID:     "net0",
+			HostDevName: tap,
+			GuestMAC:    mac,
+		})
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		runner.microCleanup()
+		return nil, nil, err
+	}
+
+	name := util.WDProject(runner.project, "runners", runner.Name(), "firecracker.json")
+
+	if err = os.MkdirAll(path.Dir(name), 0750); err != nil {
+		runner.microCleanup()
+		return nil, nil, err
+	}
+
+	if err = os.WriteFile(name, data, 0644); err != nil {
+		runner.microCleanup()
+		return nil, nil, err
+	}
+
+	call := runner.Call
+	if call == "" {
+		call = "firecracker"
+	}
+
+	return &Compiler{
+		name:        runner.name,
+		project:     runner.project,
+		Call:        call,
+		Environment: runner.Environment,
+		Arguments:   append(KVS{{Key: "-no-api"}, {Key: "-config-file", Value: name}}, runner.Arguments...),
+	}, runner.microCleanup, nil
+}
+
+func (runner *Runner) cloudHypervisor(ctx context.Context) (*Compiler, func(), error) {
+	if err := runner.microValidate(); err != nil {
+		return nil, nil, err
+	}
+
+	image, err := runner.microImage()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	initramfs, err := runner.InitramfsArchive()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tap, mac, networkCmdline, err := runner.microNetwork()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	disks, err := runner.microDisks(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	console := "console=ttyS0"
+	if runner.GetArch() == "arm64" {
+		console = "console=ttyAMA0"
+	}
+
+	arguments := KVS{
+		{Key: "-kernel", Value: image},
+		{Key: "-initramfs", Value: initramfs},
+		{Key: "-cmdline", Value: strings.Join(MergeCmdline(runner.GetCmdline(), []string{console, "panic=1", "golinux.status"}, networkCmdline), " ")},
+		{Key: "-cpus", Value: "boot=" + strconv.Itoa(runner.microCPUs())},
+		{Key: "-memory", Value: "size=" + runner.GetMemory()},
+		{Key: "-serial", Value: "tty"},
+		{Key: "-console", Value: "off"},
+	}
+
+	for _, disk := range disks {
+		value := "path=" + disk.path
+		if disk.readOnly {
+			value += ",readonly=on"
+		}
+
+		arguments = append(arguments, &KV{Key: "-disk", Value: value})
+	}
+
+	if tap != "" {
+		value := "tap=" + tap
+		if mac != "" {
+			value += ",mac=" + mac
+		}
+
+		arguments = append(arguments, &KV{Key: "-net", Value: value})
+	}
+
+	call := runner.Call
+	if call == "" {
+		call = "cloud-hypervisor"
+	}
+
+	return &Compiler{
+		name:        runner.name,
+		project:     runner.project,
+		Call:        call,
+		Environment: runner.Environment,
+		Arguments:   append(arguments, runner.Arguments...),
+	}, runner.microCleanup, nil
+}
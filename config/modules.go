@@ -0,0 +1,165 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"github.com/Dviih/golinux/kmod"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path"
+)
+
+var modulesMetadata = []string{"modules.order", "modules.builtin", "modules.builtin.modinfo"}
+
+func (kernel *Kernel) modules(ctx context.Context, writer io.Writer) error {
+	staging := util.WDModules(kernel.compiler.project, kernel.Name())
+
+	if err := os.RemoveAll(staging); err != nil {
+		return err
+	}
+
+	environment := maps.Clone(kernel.compiler.Environment)
+	if environment == nil {
+		environment = make(map[string]string)
+	}
+
+	environment["INSTALL_MOD_PATH"] = staging
+
+	compiler := &Compiler{
+		name:        "modules_install",
+		project:     kernel.compiler.project,
+		Call:        "make modules_install",
+		Environment: environment,
+		Arguments:   kernel.compiler.Arguments,
+	}
+
+	if err := compiler.Compile(ctx, writer, kernel.Path); err != nil {
+		return err
+	}
+
+	release, err := kernel.Release()
+	if err != nil {
+		return err
+	}
+
+	return kernel.InstallModules(ctx, release, staging)
+}
+
+func (kernel *Kernel) InstallModules(ctx context.Context, release, staging string) error {
+	source := path.Join(staging, "lib", "modules", release)
+	target := util.WDInitramfs(kernel.compiler.project, "lib", "modules", release)
+
+	dep, err := kmod.ReadFile(path.Join(source, "modules.dep"))
+	if err != nil {
+		return err
+	}
+
+	modules, err := dep.Resolve(kernel.Modules...)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(target, 0750); err != nil {
+		return err
+	}
+
+	for _, module := range modules {
+		if err = util.CopyFile(path.Join(target, module), path.Join(source, module)); err != nil {
+			return err
+		}
+	}
+
+	for _, metadata := range modulesMetadata {
+		if !util.Exists(path.Join(source, metadata)) {
+			continue
+		}
+
+		if err = util.CopyFile(path.Join(target, metadata), path.Join(source, metadata)); err != nil {
+			return err
+		}
+	}
+
+	return depmod(ctx, util.WDInitramfs(kernel.compiler.project), release, dep.Filter(modules))
+}
+
+func (kernel *Kernel) Prepare(ctx context.Context, writer io.Writer) error {
+	if err := kernel.config(ctx); err != nil {
+		return err
+	}
+
+	compiler := &Compiler{
+		name:        "modules_prepare",
+		project:     kernel.compiler.project,
+		Call:        "make modules_prepare",
+		Environment: kernel.compiler.Environment,
+		Arguments:   kernel.compiler.Arguments,
+	}
+
+	return compiler.Compile(ctx, writer, kernel.Path)
+}
+
+func depmod(ctx context.Context, root, release string, dep *kmod.Dep) error {
+	name := path.Join(root, "lib", "modules", release, "modules.dep")
+
+	if existing, err := kmod.ReadFile(name); err == nil {
+		var present []string
+
+		for _, module := range existing.Modules() {
+			if util.Exists(path.Join(root, "lib", "modules", release, module)) {
+				present = append(present, module)
+			}
+		}
+
+		dep = existing.Filter(present).Merge(dep)
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = dep.WriteTo(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	if _, err = exec.LookPath("depmod"); err != nil {
+		return nil
+	}
+
+	stderr := &util.Writer{}
+
+	cmd := exec.CommandContext(ctx, "depmod", "-b", root, release)
+	cmd.Stderr = stderr
+
+	if err = cmd.Run(); err != nil {
+		return stderr.Error(err)
+	}
+
+	return nil
+}
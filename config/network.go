@@ -0,0 +1,176 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	NetworkModeNone   = "none"
+	NetworkModeUser   = "user"
+	NetworkModeTap    = "tap"
+	NetworkModeBridge = "bridge"
+
+	NetworkModeMulticast = "mcast"
+	NetworkModeSocket    = "socket"
+)
+
+type Network struct {
+	Mode     string   `yaml:"mode"`
+	Forwards []string `yaml:"forwards"`
+	Tap      string   `yaml:"tap"`
+	Bridge   string   `yaml:"bridge"`
+	MAC      string   `yaml:"mac"`
+	Address  string   `yaml:"address"`
+	Gateway  string   `yaml:"gateway"`
+	DNS      string   `yaml:"dns"`
+
+	Multicast string `yaml:"multicast"`
+	Listen    string `yaml:"listen"`
+	Connect   string `yaml:"connect"`
+}
+
+func (network *Network) GetMode() string {
+	if network.Mode == "" {
+		return NetworkModeUser
+	}
+
+	return strings.ToLower(network.Mode)
+}
+
+func (network *Network) guest() (string, string, string) {
+	address, gateway, dns := network.Address, network.Gateway, network.DNS
+
+	if network.GetMode() == NetworkModeUser {
+		if address == "" {
+			address = "10.0.2.15/24"
+		}
+
+		if gateway == "" {
+			gateway = "10.0.2.2"
+		}
+
+		if dns == "" {
+			dns = "10.0.2.3"
+		}
+	}
+
+	return address, gateway, dns
+}
+
+func (network *Network) cmdline() string {
+	address, gateway, dns := network.guest()
+
+	if address == "" {
+		return "golinux.net=up"
+	}
+
+	return "golinux.net=" + strings.Join([]string{address, gateway, dns}, ",")
+}
+
+func forward(s string) (string, error) {
+	fields := strings.Split(s, ":")
+
+	protocol := "tcp"
+	if fields[0] == "tcp" || fields[0] == "udp" {
+		protocol = fields[0]
+		fields = fields[1:]
+	}
+
+	switch len(fields) {
+	case 2:
+		return protocol + "::" + fields[0] + "-:" + fields[1], nil
+	case 3:
+		return protocol + ":" + fields[0] + ":" + fields[1] + "-:" + fields[2], nil
+	default:
+		return "", errors.New("invalid forward: " + s)
+	}
+}
+
+func (network *Network) netdev(id string) (string, error) {
+	switch network.GetMode() {
+	case NetworkModeUser:
+		netdev := "user,id=" + id
+
+		for _, f := range network.Forwards {
+			hostfwd, err := forward(f)
+			if err != nil {
+				return "", err
+			}
+
+			netdev += ",hostfwd=" + hostfwd
+		}
+
+		return netdev, nil
+	case NetworkModeTap:
+		if network.Tap == "" {
+			return "", errors.New("tap network requires a tap interface")
+		}
+
+		return "tap,id=" + id + ",ifname=" + network.Tap + ",script=no,downscript=no", nil
+	case NetworkModeBridge:
+		if network.Bridge == "" {
+			return "", errors.New("bridge network requires a bridge")
+		}
+
+		return "bridge,id=" + id + ",br=" + network.Bridge, nil
+	case NetworkModeMulticast:
+		if network.Multicast == "" {
+			return "", errors.New("multicast network requires a group address")
+		}
+
+		return "socket,id=" + id + ",mcast=" + network.Multicast, nil
+	case NetworkModeSocket:
+		switch {
+		case network.Listen != "":
+			return "socket,id=" + id + ",listen=" + network.Listen, nil
+		case network.Connect != "":
+			return "socket,id=" + id + ",connect=" + network.Connect, nil
+		default:
+			return "", errors.New("socket network requires listen or connect")
+		}
+	default:
+		return "", errors.New("invalid network mode: " + network.Mode)
+	}
+}
+
+func (runner *Runner) network() (KVS, []string, error) {
+	if runner.Network == nil {
+		return nil, nil, nil
+	}
+
+	if runner.Network.GetMode() == NetworkModeNone {
+		return KVS{{Key: "nic", Value: "none"}}, nil, nil
+	}
+
+	netdev, err := runner.Network.netdev("net0")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	device := "virtio-net-pci,netdev=net0"
+	if runner.Network.MAC != "" {
+		device += ",mac=" + runner.Network.MAC
+	}
+
+	return KVS{{Key: "netdev", Value: netdev}, {Key: "device", Value: device}}, []string{runner.Network.cmdline()}, nil
+}
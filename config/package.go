@@ -21,21 +21,177 @@ package config
 
 import (
 	"context"
+	"errors"
+	"github.com/Dviih/golinux/kmod"
+	"github.com/Dviih/golinux/util"
+	"gopkg.in/yaml.v3"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
+type PackageKind int
+
+const (
+	PackageKindBinary PackageKind = iota
+	PackageKindModule
+)
+
+var namedPackageKind = map[PackageKind]string{
+	PackageKindBinary: "binary",
+	PackageKindModule: "module",
+}
+
+func (kind *PackageKind) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(s) {
+	case namedPackageKind[PackageKindBinary]:
+		*kind = PackageKindBinary
+	case namedPackageKind[PackageKindModule]:
+		*kind = PackageKindModule
+	default:
+		return errors.New("invalid PackageKind")
+	}
+
+	return nil
+}
+
+func (kind *PackageKind) MarshalYAML() (interface{}, error) {
+	return kind.String(), nil
+}
+
+func (kind *PackageKind) String() string {
+	return namedPackageKind[*kind]
+}
+
 type Package struct {
 	name     string    `yaml:"-"`
 	compiler *Compiler `yaml:"-"`
-	Target   string    `yaml:"target"`
-	Path     string    `yaml:"path"`
-	Compiler string    `yaml:"compiler"`
+	kernel   *Kernel   `yaml:"-"`
+
+	Target   string       `yaml:"target"`
+	Path     string       `yaml:"path"`
+	Compiler string       `yaml:"compiler"`
+	Kind     *PackageKind `yaml:"kind"`
+	Kernel   string       `yaml:"kernel"`
 }
 
 func (pkg *Package) Name() string {
 	return pkg.name
 }
 
+func (pkg *Package) IsModule() bool {
+	return pkg.Kind != nil && *pkg.Kind == PackageKindModule
+}
+
 func (pkg *Package) Build(ctx context.Context, writer io.Writer) error {
+	if pkg.IsModule() {
+		return pkg.module(ctx, writer)
+	}
+
 	return pkg.compiler.Compile(ctx, writer, pkg.Name())
 }
+
+func (pkg *Package) dir() string {
+	if pkg.Path != "" {
+		return pkg.Path
+	}
+
+	return util.WD(pkg.Name())
+}
+
+func (pkg *Package) module(ctx context.Context, writer io.Writer) error {
+	kernel := pkg.kernel
+
+	if kernel == nil || kernel.compiler == nil {
+		return errors.New("module package requires a kernel")
+	}
+
+	if err := kernel.Prepare(ctx, writer); err != nil {
+		return err
+	}
+
+	// modules_prepare does not produce symbol versions, only a full kernel build does.
+	symvers := filepath.Join(kernel.Path, "Module.symvers")
+
+	if !util.Exists(symvers) {
+		if err := kernel.compiler.Compile(ctx, writer, kernel.Path); err != nil {
+			return err
+		}
+
+		if !util.Exists(symvers) {
+			return errors.New("kernel " + kernel.Name() + " did not produce Module.symvers for " + pkg.Name())
+		}
+	}
+
+	compiler := &Compiler{
+		name:        pkg.Name(),
+		project:     kernel.compiler.project,
+		call:        []string{"make", "-C", kernel.Path, "M=" + pkg.dir(), "modules"},
+		Environment: kernel.compiler.Environment,
+		Arguments:   kernel.compiler.Arguments,
+	}
+
+	if err := compiler.Compile(ctx, writer, pkg.dir()); err != nil {
+		return err
+	}
+
+	release, err := kernel.Release()
+	if err != nil {
+		return err
+	}
+
+	root := util.WDInitramfs(kernel.compiler.project)
+	dep := &kmod.Dep{}
+
+	built, err := modulesOrder(pkg.dir())
+	if err != nil {
+		return err
+	}
+
+	for _, name := range built {
+		module := filepath.Join("extra", filepath.Base(name))
+
+		if err = util.CopyFile(filepath.Join(root, "lib", "modules", release, module), filepath.Join(pkg.dir(), name)); err != nil {
+			return err
+		}
+
+		dep.Add(module)
+	}
+
+	if len(dep.Modules()) == 0 {
+		return errors.New("no modules were built for " + pkg.Name())
+	}
+
+	return depmod(ctx, root, release, dep)
+}
+
+func modulesOrder(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "modules.order"))
+	if err != nil {
+		return nil, err
+	}
+
+	var modules []string
+
+	for _, line := range strings.Fields(string(data)) {
+		line = strings.TrimSuffix(line, ".o")
+		if !strings.HasSuffix(line, ".ko") {
+			line += ".ko"
+		}
+
+		if _, err = os.Stat(filepath.Join(dir, line)); err != nil {
+			line = strings.TrimPrefix(line, "kernel/")
+		}
+
+		modules = append(modules, line)
+	}
+
+	return modules, nil
+}
@@ -0,0 +1,428 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+type ExitDevice int
+
+const (
+	ExitDeviceNone ExitDevice = iota
+	ExitDeviceISADebugExit
+	ExitDeviceSemihosting
+	ExitDeviceSiFiveTest
+)
+
+type Arch struct {
+	QEMU     string
+	Image    string
+	Console  string
+	Machine  string
+	CPU      string
+	Exit     ExitDevice
+	EFI      string
+	Firmware []string
+}
+
+var archs = map[string]*Arch{
+	"amd64": {
+		QEMU:    "qemu-system-x86_64",
+		Image:   "arch/x86/boot/bzImage",
+		Console: "ttyS0",
+		Exit:    ExitDeviceISADebugExit,
+		EFI:     "BOOTX64.EFI",
+		Firmware: []string{
+			"/usr/share/ovmf/OVMF.fd",
+			"/usr/share/OVMF/OVMF.fd",
+			"/usr/share/edk2/x64/OVMF.fd",
+			"/usr/share/edk2/ovmf/OVMF.fd",
+			"/usr/share/qemu/OVMF.fd",
+		},
+	},
+	"386": {
+		QEMU:    "qemu-system-i386",
+		Image:   "arch/x86/boot/bzImage",
+		Console: "ttyS0",
+		Exit:    ExitDeviceISADebugExit,
+		EFI:     "BOOTIA32.EFI",
+		Firmware: []string{
+			"/usr/share/ovmf/OVMF32.fd",
+			"/usr/share/edk2/ia32/OVMF.fd",
+		},
+	},
+	"arm64": {
+		QEMU:    "qemu-system-aarch64",
+		Image:   "arch/arm64/boot/Image",
+		Console: "ttyAMA0",
+		Machine: "virt",
+		CPU:     "max",
+		Exit:    ExitDeviceSemihosting,
+		EFI:     "BOOTAA64.EFI",
+		Firmware: []string{
+			"/usr/share/qemu-efi-aarch64/QEMU_EFI.fd",
+			"/usr/share/AAVMF/AAVMF_CODE.fd",
+			"/usr/share/edk2/aarch64/QEMU_EFI.fd",
+			"/usr/share/qemu/edk2-aarch64-code.fd",
+		},
+	},
+	"arm": {
+		QEMU:    "qemu-system-arm",
+		Image:   "arch/arm/boot/zImage",
+		Console: "ttyAMA0",
+		Machine: "virt",
+		Exit:    ExitDeviceSemihosting,
+		EFI:     "BOOTARM.EFI",
+	},
+	"riscv64": {
+		QEMU:    "qemu-system-riscv64",
+		Image:   "arch/riscv/boot/Image",
+		Console: "ttyS0",
+		Machine: "virt",
+		Exit:    ExitDeviceSiFiveTest,
+		EFI:     "BOOTRISCV64.EFI",
+	},
+}
+
+var archAliases = map[string]string{
+	"x86_64":  "amd64",
+	"x86":     "amd64",
+	"i386":    "386",
+	"aarch64": "arm64",
+	"riscv":   "riscv64",
+}
+
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (exitError *ExitError) Error() string {
+	return "guest exited with status " + strconv.Itoa(exitError.Code)
+}
+
+func (exitError *ExitError) Unwrap() error {
+	return exitError.Err
+}
+
+func (device ExitDevice) guest(err error) error {
+	var exitError *exec.ExitError
+
+	if !errors.As(err, &exitError) {
+		return err
+	}
+
+	status := exitError.ExitCode()
+
+	switch device {
+	case ExitDeviceISADebugExit:
+		// isa-debug-exit exits with (code << 1) | 1, a status of 1 belongs to qemu itself.
+		if status < 3 || status%2 == 0 {
+			return err
+		}
+
+		return &ExitError{Code: (status - 1) >> 1, Err: err}
+	case ExitDeviceSemihosting, ExitDeviceSiFiveTest:
+		if status <= 0 {
+			return err
+		}
+
+		return &ExitError{Code: status, Err: err}
+	default:
+		return err
+	}
+}
+
+func (runner *Runner) GetArch() string {
+	arch := strings.ToLower(runner.Arch)
+
+	if arch == "" {
+		return runtime.GOARCH
+	}
+
+	if alias, ok := archAliases[arch]; ok {
+		return alias
+	}
+
+	return arch
+}
+
+func (runner *Runner) arch() (*Arch, error) {
+	arch, ok := archs[runner.GetArch()]
+	if !ok {
+		return nil, errors.New("unsupported arch: " + runner.GetArch())
+	}
+
+	return arch, nil
+}
+
+func (runner *Runner) GetConsole() string {
+	if runner.Console != "" {
+		return runner.Console
+	}
+
+	arch, err := runner.arch()
+	if err != nil {
+		return "ttyS0"
+	}
+
+	return arch.Console
+}
+
+func (runner *Runner) Image() (string, error) {
+	if runner.kernel == nil || runner.kernel.Path == "" {
+		return "", errors.New("runner requires a kernel")
+	}
+
+	arch, err := runner.arch()
+	if err != nil {
+		return "", err
+	}
+
+	image := path.Join(runner.kernel.Path, arch.Image)
+
+	if artifact := runner.artifact(ArtifactKernel, image); artifact != "" {
+		return artifact, nil
+	}
+
+	return image, nil
+}
+
+func (runner *Runner) InitramfsArchive() (string, error) {
+	source := runner.Initramfs
+	if source == "" {
+		source = util.WDInitramfs(runner.project)
+
+		if artifact := runner.artifact(ArtifactInitramfs, source); artifact != "" {
+			return artifact, nil
+		}
+	}
+
+	stat, err := os.Stat(source)
+	if err != nil {
+		return "", err
+	}
+
+	if !stat.IsDir() {
+		return source, nil
+	}
+
+	target := util.WDProject(runner.project, "runners", runner.Name(), "initramfs.cpio")
+
+	if err = os.MkdirAll(path.Dir(target), 0750); err != nil {
+		return "", err
+	}
+
+	if err = util.WriteCPIO(target, source); err != nil {
+		return "", err
+	}
+
+	return target, nil
+}
+
+func (runner *Runner) GetFirmware() (string, error) {
+	switch runner.Firmware {
+	case "":
+		if runner.Boot != "" {
+			runner := *runner
+			runner.Firmware = "efi"
+
+			return runner.GetFirmware()
+		}
+
+		return "", nil
+	case "efi", "uefi":
+		arch, err := runner.arch()
+		if err != nil {
+			return "", err
+		}
+
+		for _, firmware := range arch.Firmware {
+			if util.Exists(firmware) {
+				return firmware, nil
+			}
+		}
+
+		return "", errors.New("no uefi firmware found for arch " + runner.GetArch())
+	default:
+		if runner.Firmware[0] == '/' {
+			return runner.Firmware, nil
+		}
+
+		return util.WD(runner.Firmware), nil
+	}
+}
+
+func (runner *Runner) GetBoot() string {
+	if runner.Boot == "" || runner.Boot[0] == '/' {
+		return runner.Boot
+	}
+
+	return util.WD(runner.Boot)
+}
+
+func (runner *Runner) accelerated() bool {
+	if runner.GetKind() != RunnerKindKVM || runner.GetArch() != runtime.GOARCH {
+		return false
+	}
+
+	file, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+
+	file.Close()
+	return true
+}
+
+func (runner *Runner) GetMemory() string {
+	if runner.Memory == "" {
+		return "128M"
+	}
+
+	return runner.Memory
+}
+
+func (runner *Runner) qemu(ctx context.Context) (*Compiler, func(), error) {
+	arch, err := runner.arch()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	call := runner.Call
+	if call == "" {
+		call = arch.QEMU
+	}
+
+	vsock, vsockCmdline := runner.vsock()
+	debug, debugCmdline := runner.debugArguments()
+
+	network, networkCmdline, err := runner.network()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	disks, err := runner.disks(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shares, sharesCmdline, cleanup, err := runner.shares(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var arguments KVS
+
+	if runner.Boot != "" {
+		arguments = KVS{
+			{Key: "drive", Value: "file=" + qemuEscape(runner.GetBoot()) + ",format=raw,if=none,id=boot,readonly=on"},
+			{Key: "device", Value: "virtio-blk-pci,drive=boot,bootindex=0"},
+		}
+	} else {
+		image, err := runner.Image()
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+
+		initramfs, err := runner.InitramfsArchive()
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+
+		arguments = KVS{
+			{Key: "kernel", Value: image},
+			{Key: "initrd", Value: initramfs},
+			{Key: "append", Value: strings.Join(MergeCmdline(runner.GetCmdline(), vsockCmdline, networkCmdline, sharesCmdline, debugCmdline), " ")},
+		}
+	}
+
+	// QEMU defaults to the same 128M as GetMemory, only pass it when set.
+	if runner.Memory != "" {
+		arguments = append(arguments, &KV{Key: "m", Value: runner.Memory})
+	}
+
+	firmware, err := runner.GetFirmware()
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	if firmware != "" {
+		arguments = append(arguments, &KV{Key: "bios", Value: firmware})
+	}
+
+	if arch.Machine != "" {
+		arguments = append(arguments, &KV{Key: "machine", Value: arch.Machine})
+	}
+
+	if runner.accelerated() {
+		arguments = append(arguments, &KV{Key: "enable-kvm"}, &KV{Key: "cpu", Value: "host"})
+	} else {
+		arguments = append(arguments, &KV{Key: "accel", Value: "tcg"})
+
+		if arch.CPU != "" {
+			arguments = append(arguments, &KV{Key: "cpu", Value: arch.CPU})
+		}
+	}
+
+	switch arch.Exit {
+	case ExitDeviceISADebugExit:
+		arguments = append(arguments, &KV{Key: "device", Value: "isa-debug-exit,iobase=0xf4,iosize=0x04"})
+	case ExitDeviceSemihosting:
+		arguments = append(arguments, &KV{Key: "semihosting-config", Value: "enable=on,target=native,userspace=on"})
+	}
+
+	arguments = append(arguments, &KV{Key: "no-reboot"})
+	arguments = append(arguments, vsock...)
+	arguments = append(arguments, debug...)
+	arguments = append(arguments, network...)
+	arguments = append(arguments, disks...)
+	arguments = append(arguments, shares...)
+
+	if runner.CPUs > 0 {
+		arguments = append(arguments, &KV{Key: "smp", Value: strconv.Itoa(runner.CPUs)})
+	}
+
+	if runner.detached {
+		arguments = append(arguments, runner.detachArguments()...)
+	} else if !runner.Graphic {
+		arguments = append(arguments, &KV{Key: "nographic"})
+	}
+
+	return &Compiler{
+		name:        runner.name,
+		project:     runner.project,
+		Call:        call,
+		Environment: runner.Environment,
+		Arguments:   append(arguments, runner.Arguments...),
+	}, cleanup, nil
+}
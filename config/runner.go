@@ -22,9 +22,11 @@ package config
 import (
 	"context"
 	"errors"
+	"github.com/Dviih/golinux/expect"
 	"github.com/Dviih/golinux/util"
 	"gopkg.in/yaml.v3"
 	"io"
+	"os/exec"
 	"strings"
 )
 
@@ -34,12 +36,22 @@ const (
 	RunnerKindCommand RunnerKind = iota
 	RunnerKindQEMU
 	RunnerKindKVM
+	RunnerKindFirecracker
+	RunnerKindCloudHypervisor
+	RunnerKindContainer
+	RunnerKindChroot
 )
 
 var namedRunnerKind = map[RunnerKind]string{
 	RunnerKindCommand: "command",
 	RunnerKindQEMU:    "qemu",
 	RunnerKindKVM:     "kvm",
+
+	RunnerKindFirecracker:     "firecracker",
+	RunnerKindCloudHypervisor: "cloud-hypervisor",
+
+	RunnerKindContainer: "container",
+	RunnerKindChroot:    "chroot",
 }
 
 func (kind *RunnerKind) UnmarshalYAML(node *yaml.Node) error {
@@ -56,6 +68,14 @@ func (kind *RunnerKind) UnmarshalYAML(node *yaml.Node) error {
 		*kind = RunnerKindQEMU
 	case namedRunnerKind[RunnerKindKVM]:
 		*kind = RunnerKindKVM
+	case namedRunnerKind[RunnerKindFirecracker]:
+		*kind = RunnerKindFirecracker
+	case namedRunnerKind[RunnerKindCloudHypervisor]:
+		*kind = RunnerKindCloudHypervisor
+	case namedRunnerKind[RunnerKindContainer]:
+		*kind = RunnerKindContainer
+	case namedRunnerKind[RunnerKindChroot]:
+		*kind = RunnerKindChroot
 	default:
 		return errors.New("invalid RunnerKind")
 	}
@@ -74,13 +94,91 @@ func (kind *RunnerKind) String() string {
 type Runner struct {
 	name        string            `yaml:"-"`
 	project     string            `yaml:"-"`
+	kernel      *Kernel           `yaml:"-"`
+	instance    string            `yaml:"-"`
+	debug       *runnerDebug      `yaml:"-"`
+	detached    bool              `yaml:"-"`
+	helpers     []*exec.Cmd       `yaml:"-"`
 	Call        string            `yaml:"call"`
 	Kind        *RunnerKind       `yaml:"kind"`
 	Environment map[string]string `yaml:"environment"`
 	Arguments   KVS               `yaml:"arguments"`
+
+	Kernel    string   `yaml:"kernel"`
+	Arch      string   `yaml:"arch"`
+	Memory    string   `yaml:"memory"`
+	CPUs      int      `yaml:"cpus"`
+	Console   string   `yaml:"console"`
+	Graphic   bool     `yaml:"graphic"`
+	Initramfs string   `yaml:"initramfs"`
+	Cmdline   []string `yaml:"cmdline"`
+	Firmware  string   `yaml:"firmware"`
+	Boot      string   `yaml:"boot"`
+
+	Test   *RunnerTest    `yaml:"test"`
+	Script []*expect.Step `yaml:"script"`
+	Vsock  *RunnerVsock   `yaml:"vsock"`
+
+	Shares  []*Share `yaml:"shares"`
+	Network *Network `yaml:"network"`
+	Disks   []*Disk  `yaml:"disks"`
+}
+
+func (runner *Runner) Name() string {
+	return runner.name
+}
+
+func (runner *Runner) GetKernel() *Kernel {
+	if runner.kernel == nil {
+		return &Kernel{}
+	}
+
+	return runner.kernel
+}
+
+func (runner *Runner) GetKind() RunnerKind {
+	if runner.Kind == nil {
+		return RunnerKindCommand
+	}
+
+	return *runner.Kind
 }
 
 func (runner *Runner) Execute(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	switch runner.GetKind() {
+	case RunnerKindQEMU, RunnerKindKVM:
+		arch, err := runner.arch()
+		if err != nil {
+			return err
+		}
+
+		compiler, cleanup, err := runner.qemu(ctx)
+		if err != nil {
+			return err
+		}
+
+		defer cleanup()
+
+		return arch.Exit.guest(compiler.compile(ctx, stdin, stdout, stderr, util.WDProject(runner.project)))
+	case RunnerKindFirecracker, RunnerKindCloudHypervisor:
+		microVM := runner.firecracker
+		if runner.GetKind() == RunnerKindCloudHypervisor {
+			microVM = runner.cloudHypervisor
+		}
+
+		compiler, cleanup, err := microVM(ctx)
+		if err != nil {
+			return err
+		}
+
+		defer cleanup()
+
+		status := &statusWriter{writer: stdout}
+		return status.guest(compiler.compile(ctx, stdin, status, stderr, util.WDProject(runner.project)))
+	case RunnerKindContainer, RunnerKindChroot:
+		return runner.container(ctx, stdin, stdout, stderr)
+	}
+
 	compiler := &Compiler{
 		name:        runner.name,
 		project:     runner.project,
@@ -91,3 +189,109 @@ func (runner *Runner) Execute(ctx context.Context, stdin io.Reader, stdout io.Wr
 
 	return compiler.compile(ctx, stdin, stdout, stderr, util.WDProject(compiler.project))
 }
+
+func (runner *Runner) KernelOptions() map[string]string {
+	options := make(map[string]string)
+
+	if len(runner.Shares) > 0 {
+		options["CONFIG_PCI"] = "y"
+		options["CONFIG_VIRTIO_PCI"] = "y"
+	}
+
+	for _, share := range runner.Shares {
+		switch share.GetType() {
+		case ShareType9P:
+			options["CONFIG_NET_9P"] = "y"
+			options["CONFIG_NET_9P_VIRTIO"] = "y"
+			options["CONFIG_9P_FS"] = "y"
+		case ShareTypeVirtioFS:
+			options["CONFIG_FUSE_FS"] = "y"
+			options["CONFIG_VIRTIO_FS"] = "y"
+		}
+	}
+
+	if runner.Network != nil && runner.Network.GetMode() != NetworkModeNone {
+		options["CONFIG_NET"] = "y"
+		options["CONFIG_INET"] = "y"
+		options["CONFIG_NETDEVICES"] = "y"
+		options["CONFIG_PCI"] = "y"
+		options["CONFIG_VIRTIO_PCI"] = "y"
+		options["CONFIG_VIRTIO_NET"] = "y"
+	}
+
+	for _, disk := range runner.Disks {
+		options["CONFIG_BLOCK"] = "y"
+		options["CONFIG_PCI"] = "y"
+
+		switch disk.GetInterface() {
+		case DiskInterfaceVirtio:
+			options["CONFIG_VIRTIO_PCI"] = "y"
+			options["CONFIG_VIRTIO_BLK"] = "y"
+		case DiskInterfaceNVMe:
+			options["CONFIG_BLK_DEV_NVME"] = "y"
+		case DiskInterfaceSCSI:
+			options["CONFIG_VIRTIO_PCI"] = "y"
+			options["CONFIG_SCSI"] = "y"
+			options["CONFIG_BLK_DEV_SD"] = "y"
+			options["CONFIG_SCSI_VIRTIO"] = "y"
+		}
+
+		switch strings.ToLower(disk.Filesystem) {
+		case "ext2", "ext3", "ext4":
+			options["CONFIG_EXT4_FS"] = "y"
+		case "vfat", "fat":
+			options["CONFIG_VFAT_FS"] = "y"
+			options["CONFIG_NLS_CODEPAGE_437"] = "y"
+			options["CONFIG_NLS_ISO8859_1"] = "y"
+		}
+	}
+
+	if runner.Vsock != nil && runner.Vsock.CID >= 3 {
+		options["CONFIG_VSOCKETS"] = "y"
+		options["CONFIG_VIRTIO_VSOCKETS"] = "y"
+	}
+
+	if runner.Firmware != "" || runner.Boot != "" {
+		options["CONFIG_EFI"] = "y"
+		options["CONFIG_EFI_STUB"] = "y"
+	}
+
+	switch runner.GetKind() {
+	case RunnerKindQEMU, RunnerKindKVM:
+		// system_powerdown reaches initrd as a power key input event.
+		options["CONFIG_INPUT"] = "y"
+		options["CONFIG_INPUT_EVDEV"] = "y"
+
+		switch runner.GetArch() {
+		case "amd64", "386":
+			options["CONFIG_ACPI"] = "y"
+			options["CONFIG_ACPI_BUTTON"] = "y"
+		case "arm64", "arm":
+			options["CONFIG_INPUT_KEYBOARD"] = "y"
+			options["CONFIG_KEYBOARD_GPIO"] = "y"
+			options["CONFIG_GPIO_PL061"] = "y"
+		}
+
+		return options
+	case RunnerKindFirecracker:
+		options["CONFIG_VIRTIO_MMIO"] = "y"
+		options["CONFIG_VIRTIO_MMIO_CMDLINE_DEVICES"] = "y"
+		options["CONFIG_SERIAL_8250"] = "y"
+		options["CONFIG_SERIAL_8250_CONSOLE"] = "y"
+	case RunnerKindCloudHypervisor:
+		options["CONFIG_PCI"] = "y"
+		options["CONFIG_VIRTIO_PCI"] = "y"
+	default:
+		return options
+	}
+
+	if len(runner.Disks) > 0 {
+		options["CONFIG_VIRTIO_BLK"] = "y"
+	}
+
+	if runner.GetArch() == "amd64" {
+		options["CONFIG_PVH"] = "y"
+	}
+
+	return options
+}
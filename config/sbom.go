@@ -0,0 +1,397 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"debug/buildinfo"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ArtifactSBOM = "sbom"
+
+	spdxNoAssertion = "NOASSERTION"
+)
+
+var spdxInvalid = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+type SPDXChecksum struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"checksumValue"`
+}
+
+type SPDXExternalRef struct {
+	Category string `json:"referenceCategory"`
+	Type     string `json:"referenceType"`
+	Locator  string `json:"referenceLocator"`
+}
+
+type SPDXPackage struct {
+	ID               string             `json:"SPDXID"`
+	Name             string             `json:"name"`
+	Version          string             `json:"versionInfo,omitempty"`
+	FileName         string             `json:"packageFileName,omitempty"`
+	DownloadLocation string             `json:"downloadLocation"`
+	FilesAnalyzed    bool               `json:"filesAnalyzed"`
+	LicenseDeclared  string             `json:"licenseDeclared"`
+	Checksums        []*SPDXChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []*SPDXExternalRef `json:"externalRefs,omitempty"`
+	Comment          string             `json:"comment,omitempty"`
+}
+
+type SPDXFile struct {
+	ID        string          `json:"SPDXID"`
+	Name      string          `json:"fileName"`
+	Checksums []*SPDXChecksum `json:"checksums"`
+	Comment   string          `json:"comment,omitempty"`
+}
+
+type SPDXRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+type SPDXCreationInfo struct {
+	Created  time.Time `json:"created"`
+	Creators []string  `json:"creators"`
+}
+
+type SPDXDocument struct {
+	Version       string              `json:"spdxVersion"`
+	DataLicense   string              `json:"dataLicense"`
+	ID            string              `json:"SPDXID"`
+	Name          string              `json:"name"`
+	Namespace     string              `json:"documentNamespace"`
+	CreationInfo  SPDXCreationInfo    `json:"creationInfo"`
+	Packages      []*SPDXPackage      `json:"packages"`
+	Files         []*SPDXFile         `json:"files,omitempty"`
+	Relationships []*SPDXRelationship `json:"relationships"`
+
+	ids  map[string]string
+	used map[string]bool
+}
+
+func spdxID(kind string, names ...string) string {
+	return "SPDXRef-" + kind + "-" + strings.Trim(spdxInvalid.ReplaceAllString(strings.Join(names, "-"), "-"), "-")
+}
+
+// id returns the SPDX id of the element named by names, sanitizing can map
+// different names to one id so later ones get a numeric suffix.
+func (document *SPDXDocument) id(kind string, names ...string) string {
+	if document.ids == nil {
+		document.ids = make(map[string]string)
+		document.used = make(map[string]bool)
+	}
+
+	key := kind + "\x00" + strings.Join(names, "\x00")
+
+	if id, ok := document.ids[key]; ok {
+		return id
+	}
+
+	id := spdxID(kind, names...)
+
+	for i := 2; document.used[id]; i++ {
+		id = spdxID(kind, strings.Join(names, "-"), strconv.Itoa(i))
+	}
+
+	document.ids[key] = id
+	document.used[id] = true
+
+	return id
+}
+
+func checksums(name string) ([]*SPDXChecksum, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	sum1, sum256 := sha1.New(), sha256.New()
+
+	if _, err = io.Copy(io.MultiWriter(sum1, sum256), file); err != nil {
+		return nil, err
+	}
+
+	return []*SPDXChecksum{
+		{Algorithm: "SHA1", Value: hex.EncodeToString(sum1.Sum(nil))},
+		{Algorithm: "SHA256", Value: hex.EncodeToString(sum256.Sum(nil))},
+	}, nil
+}
+
+func (document *SPDXDocument) relate(element, kind, related string) {
+	document.Relationships = append(document.Relationships, &SPDXRelationship{Element: element, Type: kind, Related: related})
+}
+
+func (document *SPDXDocument) add(pkg *SPDXPackage) {
+	for _, current := range document.Packages {
+		if current.ID == pkg.ID {
+			return
+		}
+	}
+
+	document.Packages = append(document.Packages, pkg)
+}
+
+func (kernel *Kernel) GetPatches() []string {
+	var patches []string
+
+	for _, patch := range kernel.Patches {
+		patches = append(patches, wdPath(patch))
+	}
+
+	return patches
+}
+
+func (document *SPDXDocument) kernel(kernel *Kernel, release, root string) error {
+	id := document.id("Kernel", kernel.Name())
+
+	document.add(&SPDXPackage{
+		ID:               id,
+		Name:             "linux",
+		Version:          release,
+		DownloadLocation: spdxNoAssertion,
+		LicenseDeclared:  "GPL-2.0-only WITH Linux-syscall-note",
+		ExternalRefs: []*SPDXExternalRef{
+			{Category: "SECURITY", Type: "cpe23Type", Locator: "cpe:2.3:o:linux:linux_kernel:" + strings.SplitN(release, "-", 2)[0] + ":*:*:*:*:*:*:*"},
+		},
+		Comment: "kernel " + kernel.Name(),
+	})
+
+	document.relate(root, "CONTAINS", id)
+
+	for i, patch := range kernel.GetPatches() {
+		sums, err := checksums(patch)
+		if err != nil {
+			return err
+		}
+
+		file := document.id("Patch", strconv.Itoa(i), path.Base(patch))
+
+		document.Files = append(document.Files, &SPDXFile{
+			ID:        file,
+			Name:      "./patches/" + path.Base(patch),
+			Checksums: sums,
+			Comment:   "applied to kernel " + kernel.Name(),
+		})
+
+		document.relate(file, "PATCH_APPLIED", id)
+	}
+
+	return nil
+}
+
+func (document *SPDXDocument) binary(name, rel, root string, info *buildinfo.BuildInfo) error {
+	sums, err := checksums(name)
+	if err != nil {
+		return err
+	}
+
+	id := document.id("Binary", rel)
+
+	version := info.Main.Version
+	if version == "" || version == "(devel)" {
+		version = spdxNoAssertion
+	}
+
+	binary := &SPDXPackage{
+		ID:               id,
+		Name:             info.Path,
+		Version:          version,
+		FileName:         "./" + rel,
+		DownloadLocation: spdxNoAssertion,
+		LicenseDeclared:  spdxNoAssertion,
+		Checksums:        sums,
+		Comment:          "built with " + info.GoVersion,
+	}
+
+	if info.Main.Path != "" {
+		binary.ExternalRefs = append(binary.ExternalRefs, &SPDXExternalRef{Category: "PACKAGE-MANAGER", Type: "purl", Locator: "pkg:golang/" + info.Main.Path})
+	}
+
+	document.add(binary)
+	document.relate(root, "CONTAINS", id)
+
+	stdlib := document.id("Go", "stdlib", info.GoVersion)
+
+	document.add(&SPDXPackage{
+		ID:               stdlib,
+		Name:             "stdlib",
+		Version:          info.GoVersion,
+		DownloadLocation: "https://go.dev/dl/",
+		LicenseDeclared:  "BSD-3-Clause",
+		ExternalRefs: []*SPDXExternalRef{
+			{Category: "PACKAGE-MANAGER", Type: "purl", Locator: "pkg:golang/stdlib@" + info.GoVersion},
+		},
+	})
+
+	document.relate(id, "DEPENDS_ON", stdlib)
+
+	for _, dep := range info.Deps {
+		name, version, sum := dep.Path, dep.Version, dep.Sum
+		comment := ""
+
+		// a replacement by a local directory has no version of its own.
+		if replace := dep.Replace; replace != nil {
+			version, sum = replace.Version, replace.Sum
+
+			if replace.Version != "" {
+				name = replace.Path
+			} else {
+				comment = "replaced by " + replace.Path
+			}
+		}
+
+		module := document.id("Go", name, version)
+
+		pkg := &SPDXPackage{
+			ID:               module,
+			Name:             name,
+			Version:          version,
+			DownloadLocation: spdxNoAssertion,
+			LicenseDeclared:  spdxNoAssertion,
+			Comment:          comment,
+		}
+
+		if version != "" {
+			pkg.ExternalRefs = append(pkg.ExternalRefs, &SPDXExternalRef{Category: "PACKAGE-MANAGER", Type: "purl", Locator: "pkg:golang/" + name + "@" + version})
+		}
+
+		if sum != "" {
+			pkg.Comment = "go.sum " + sum
+		}
+
+		document.add(pkg)
+		document.relate(id, "DEPENDS_ON", module)
+	}
+
+	return nil
+}
+
+func (build *Build) AddSBOM(ctx context.Context) error {
+	manifest := build.manifest
+
+	creator := "Tool: golinux"
+	if manifest.Version != "" {
+		creator += "-" + manifest.Version
+	}
+
+	document := &SPDXDocument{
+		Version:     "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		ID:          "SPDXRef-DOCUMENT",
+		Name:        "golinux-" + manifest.Project + "-" + manifest.ID,
+		Namespace:   "https://spdx.org/spdxdocs/golinux-" + manifest.Project + "-" + manifest.ID,
+		CreationInfo: SPDXCreationInfo{
+			Created:  time.Now().UTC().Truncate(time.Second),
+			Creators: []string{creator},
+		},
+	}
+
+	root := document.id("Image", manifest.Project)
+
+	document.add(&SPDXPackage{
+		ID:               root,
+		Name:             manifest.Project,
+		Version:          manifest.ID,
+		DownloadLocation: spdxNoAssertion,
+		LicenseDeclared:  spdxNoAssertion,
+	})
+
+	document.relate(document.ID, "DESCRIBES", root)
+
+	if build.kernel != nil {
+		if err := document.kernel(build.kernel, manifest.Release, root); err != nil {
+			return err
+		}
+	}
+
+	initramfs := util.WDInitramfs(manifest.Project)
+
+	err := filepath.WalkDir(initramfs, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(initramfs, name)
+		if err != nil {
+			return err
+		}
+
+		if info, err := buildinfo.ReadFile(name); err == nil {
+			return document.binary(name, rel, root, info)
+		}
+
+		sums, err := checksums(name)
+		if err != nil {
+			return err
+		}
+
+		id := document.id("File", rel)
+
+		document.Files = append(document.Files, &SPDXFile{
+			ID:        id,
+			Name:      "./" + rel,
+			Checksums: sums,
+		})
+
+		document.relate(root, "CONTAINS", id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	name := path.Join(build.dir, "sbom.spdx.json.tmp")
+	defer os.Remove(name)
+
+	if err = os.WriteFile(name, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+
+	_, err = build.Add(ArtifactSBOM, "sbom.spdx.json", name)
+	return err
+}
@@ -0,0 +1,189 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"errors"
+	"github.com/Dviih/golinux/qmp"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"time"
+)
+
+const sessionTimeout = 10 * time.Second
+
+type Session struct {
+	*qmp.Client
+
+	cmd    *exec.Cmd
+	socket string
+	done   chan struct{}
+	err    error
+}
+
+func (runner *Runner) Instance() string {
+	if runner.instance != "" {
+		return runner.instance
+	}
+
+	return runner.name
+}
+
+func (runner *Runner) QMPSocket() string {
+	return util.WDInstance(runner.project, runner.Instance(), "qmp.sock")
+}
+
+func (runner *Runner) Start(ctx context.Context, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*Session, error) {
+	switch kind := runner.GetKind(); kind {
+	case RunnerKindQEMU, RunnerKindKVM:
+	default:
+		return nil, errors.New("runner kind " + kind.String() + " does not support sessions")
+	}
+
+	arch, err := runner.arch()
+	if err != nil {
+		return nil, err
+	}
+
+	// each session gets its own socket, the runner-wide one belongs to `up`.
+	dir, err := os.MkdirTemp("", "golinux-qmp-")
+	if err != nil {
+		return nil, err
+	}
+
+	socket := path.Join(dir, "qmp.sock")
+
+	compiler, qemuCleanup, err := runner.qemu(ctx)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	cleanup := func() {
+		qemuCleanup()
+		os.RemoveAll(dir)
+	}
+
+	compiler.Arguments = append(compiler.Arguments, &KV{Key: "qmp", Value: "unix:" + qemuEscape(socket) + ",server=on,wait=off"})
+
+	session := &Session{
+		cmd:    compiler.command(ctx, stdin, stdout, stderr, util.WDProject(runner.project)),
+		socket: socket,
+		done:   make(chan struct{}),
+	}
+
+	if err = session.cmd.Start(); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	go func() {
+		session.err = arch.Exit.guest(session.cmd.Wait())
+		cleanup()
+
+		close(session.done)
+	}()
+
+	if session.Client, err = session.connect(ctx, socket); err != nil {
+		_ = session.Kill()
+		<-session.done
+
+		if session.err != nil {
+			return nil, errors.Join(err, session.err)
+		}
+
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (session *Session) connect(ctx context.Context, socket string) (*qmp.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, sessionTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if util.Exists(socket) {
+			client, err := qmp.Dial(ctx, socket)
+			if err == nil {
+				return client, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-session.done:
+			return nil, errors.New("runner exited before qmp was available")
+		case <-ticker.C:
+		}
+	}
+}
+
+func (session *Session) Socket() string {
+	return session.socket
+}
+
+func (session *Session) Pid() int {
+	return session.cmd.Process.Pid
+}
+
+func (session *Session) Done() <-chan struct{} {
+	return session.done
+}
+
+func (session *Session) Wait() error {
+	<-session.done
+
+	if session.Client != nil {
+		session.Client.Close()
+	}
+
+	return session.err
+}
+
+func (session *Session) Kill() error {
+	return session.cmd.Process.Kill()
+}
+
+func (session *Session) Close(ctx context.Context) error {
+	if session.Client != nil {
+		if err := session.Client.Quit(ctx); err == nil {
+			return session.Wait()
+		}
+	}
+
+	if err := session.Kill(); err != nil {
+		return err
+	}
+
+	return session.Wait()
+}
+
+func (runner *Runner) QMP(ctx context.Context) (*qmp.Client, error) {
+	return qmp.Dial(ctx, runner.QMPSocket())
+}
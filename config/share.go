@@ -0,0 +1,263 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Dviih/golinux/util"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	ShareType9P       = "9p"
+	ShareTypeVirtioFS = "virtiofs"
+)
+
+var (
+	virtiofsdPaths = []string{"/usr/libexec/virtiofsd", "/usr/lib/qemu/virtiofsd", "/usr/lib/virtiofsd"}
+
+	// tags double as qemu ids, which only allow these characters.
+	shareTag = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+)
+
+type Share struct {
+	Host     string `yaml:"host"`
+	Tag      string `yaml:"tag"`
+	Guest    string `yaml:"guest"`
+	Type     string `yaml:"type"`
+	ReadOnly bool   `yaml:"readonly"`
+}
+
+func virtiofsd() (string, bool) {
+	if p, err := exec.LookPath("virtiofsd"); err == nil {
+		return p, true
+	}
+
+	for _, p := range virtiofsdPaths {
+		if util.Exists(p) {
+			return p, true
+		}
+	}
+
+	return "", false
+}
+
+func (share *Share) GetType() string {
+	switch strings.ToLower(share.Type) {
+	case ShareType9P:
+		return ShareType9P
+	case ShareTypeVirtioFS:
+		return ShareTypeVirtioFS
+	}
+
+	if _, ok := virtiofsd(); ok {
+		return ShareTypeVirtioFS
+	}
+
+	return ShareType9P
+}
+
+func (share *Share) GetHost() string {
+	if share.Host == "" || share.Host[0] == '/' {
+		return share.Host
+	}
+
+	return util.WD(share.Host)
+}
+
+func (share *Share) GetGuest() string {
+	if share.Guest != "" {
+		return share.Guest
+	}
+
+	return path.Join("/mnt", share.Tag)
+}
+
+// shareEscape percent-encodes the separators of golinux.shares and whitespace,
+// initrd reverses it with url.PathUnescape.
+func shareEscape(s string) string {
+	var builder strings.Builder
+
+	for _, c := range []byte(s) {
+		switch c {
+		case '%', ':', ',', ' ', '\t', '\n', '"':
+			fmt.Fprintf(&builder, "%%%02X", c)
+		default:
+			builder.WriteByte(c)
+		}
+	}
+
+	return builder.String()
+}
+
+func (share *Share) cmdline() string {
+	s := share.Tag + ":" + shareEscape(share.GetGuest()) + ":" + share.GetType()
+
+	if share.ReadOnly {
+		s += ":ro"
+	}
+
+	return s
+}
+
+func waitSocket(ctx context.Context, name string) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !util.Exists(name) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+func (runner *Runner) shares(ctx context.Context) (KVS, []string, func(), error) {
+	if len(runner.Shares) == 0 {
+		return nil, nil, func() {}, nil
+	}
+
+	var (
+		arguments KVS
+		shares    []string
+		processes []*exec.Cmd
+		memfd     bool
+	)
+
+	cleanup := func() {
+		for _, process := range processes {
+			if process.Process != nil {
+				_ = process.Process.Kill()
+				_ = process.Wait()
+			}
+		}
+	}
+
+	for _, share := range runner.Shares {
+		if share.Tag == "" || share.Host == "" {
+			cleanup()
+			return nil, nil, nil, errors.New("share requires host and tag")
+		}
+
+		if !shareTag.MatchString(share.Tag) {
+			cleanup()
+			return nil, nil, nil, errors.New("invalid share tag: " + share.Tag)
+		}
+
+		shares = append(shares, share.cmdline())
+
+		switch share.GetType() {
+		case ShareType9P:
+			value := "local,path=" + qemuEscape(share.GetHost()) + ",mount_tag=" + share.Tag + ",security_model=none,id=" + share.Tag
+			if share.ReadOnly {
+				value += ",readonly=on"
+			}
+
+			arguments = append(arguments, &KV{Key: "virtfs", Value: value})
+		case ShareTypeVirtioFS:
+			binary, ok := virtiofsd()
+			if !ok {
+				cleanup()
+				return nil, nil, nil, errors.New("virtiofsd not found")
+			}
+
+			socket := util.WDInstance(runner.project, runner.Instance(), share.Tag+".virtiofs.sock")
+
+			if err := os.MkdirAll(path.Dir(socket), 0750); err != nil {
+				cleanup()
+				return nil, nil, nil, err
+			}
+
+			_ = os.Remove(socket)
+
+			args := []string{"--socket-path=" + socket, "--shared-dir=" + share.GetHost(), "--cache=auto", "--sandbox=none"}
+			if share.ReadOnly {
+				args = append(args, "--readonly")
+			}
+
+			process := exec.CommandContext(ctx, binary, args...)
+			stderr := &util.Writer{}
+			process.Stderr = stderr
+
+			// helpers of a detached runner outlive this process and are stopped by Down.
+			if runner.detached {
+				log, err := os.Create(strings.TrimSuffix(socket, ".sock") + ".log")
+				if err != nil {
+					cleanup()
+					return nil, nil, nil, err
+				}
+
+				process = exec.Command(binary, args...)
+				process.Stderr = log
+				process.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+				err = process.Start()
+				log.Close()
+
+				if err != nil {
+					cleanup()
+					return nil, nil, nil, err
+				}
+
+				runner.helpers = append(runner.helpers, process)
+			} else if err := process.Start(); err != nil {
+				cleanup()
+				return nil, nil, nil, stderr.Error(err)
+			}
+
+			processes = append(processes, process)
+
+			waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			err := waitSocket(waitCtx, socket)
+			cancel()
+
+			if err != nil {
+				cleanup()
+				return nil, nil, nil, stderr.Error(err)
+			}
+
+			memfd = true
+			arguments = append(arguments,
+				&KV{Key: "chardev", Value: "socket,id=" + share.Tag + ",path=" + qemuEscape(socket)},
+				&KV{Key: "device", Value: "vhost-user-fs-pci,chardev=" + share.Tag + ",tag=" + share.Tag},
+			)
+		}
+	}
+
+	if memfd {
+		arguments = append(arguments,
+			&KV{Key: "object", Value: "memory-backend-memfd,id=mem,size=" + runner.GetMemory() + ",share=on"},
+			&KV{Key: "numa", Value: "node,memdev=mem"},
+		)
+	}
+
+	return arguments, []string{"golinux.shares=" + strings.Join(shares, ",")}, cleanup, nil
+}
@@ -0,0 +1,48 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestShareCmdline(t *testing.T) {
+	guests := []string{"/mnt/data", "/mnt/a:b", "/mnt/a,b", "/mnt/with space", "/mnt/100%"}
+
+	for _, guest := range guests {
+		share := &Share{Tag: "data", Guest: guest, Type: ShareType9P, ReadOnly: true}
+
+		fields := strings.Split(share.cmdline(), ":")
+		if len(fields) != 4 || strings.ContainsAny(share.cmdline(), ", ") {
+			t.Fatalf("%q: invalid cmdline %q", guest, share.cmdline())
+		}
+
+		target, err := url.PathUnescape(fields[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if target != guest {
+			t.Errorf("got %q, want %q", target, guest)
+		}
+	}
+}
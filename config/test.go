@@ -0,0 +1,286 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"errors"
+	"github.com/Dviih/golinux/crash"
+	"github.com/Dviih/golinux/expect"
+	"github.com/Dviih/golinux/util"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const DefaultTestTimeout = time.Minute
+
+const testCrashGrace = 2 * time.Second
+
+var defaultTestFailures = []string{
+	`Kernel panic`,
+	`Attempted to kill init`,
+}
+
+var errTestMatched = errors.New("test marker matched")
+
+type RunnerTest struct {
+	Success []string      `yaml:"success"`
+	Failure []string      `yaml:"failure"`
+	Timeout time.Duration `yaml:"timeout"`
+	Log     string        `yaml:"log"`
+}
+
+type TestResult struct {
+	Passed   bool
+	Reason   string
+	Match    string
+	Log      string
+	Duration time.Duration
+	Crashes  []*crash.Report
+	Err      error
+}
+
+type testMatcher struct {
+	m      sync.Mutex
+	line   []byte
+	result *TestResult
+	cancel context.CancelCauseFunc
+	grace  *time.Timer
+
+	success []*regexp.Regexp
+	failure []*regexp.Regexp
+}
+
+func (matcher *testMatcher) Write(data []byte) (int, error) {
+	defer matcher.m.Unlock()
+	matcher.m.Lock()
+
+	for _, b := range data {
+		if b == '\n' {
+			matcher.match()
+			matcher.line = matcher.line[:0]
+
+			continue
+		}
+
+		matcher.line = append(matcher.line, b)
+	}
+
+	matcher.match()
+	return len(data), nil
+}
+
+func (matcher *testMatcher) match() {
+	if matcher.result != nil || len(matcher.line) == 0 {
+		return
+	}
+
+	for _, re := range matcher.failure {
+		if match := re.Find(matcher.line); match != nil {
+			matcher.result = &TestResult{Reason: "failure marker matched", Match: string(match)}
+			matcher.grace = time.AfterFunc(testCrashGrace, func() {
+				matcher.cancel(errTestMatched)
+			})
+
+			return
+		}
+	}
+
+	for _, re := range matcher.success {
+		if match := re.Find(matcher.line); match != nil {
+			matcher.result = &TestResult{Passed: true, Reason: "success marker matched", Match: string(match)}
+			matcher.cancel(errTestMatched)
+
+			return
+		}
+	}
+}
+
+func (matcher *testMatcher) finish(result *TestResult) {
+	defer matcher.m.Unlock()
+	matcher.m.Lock()
+
+	if matcher.result != nil {
+		return
+	}
+
+	matcher.result = result
+	matcher.cancel(errTestMatched)
+}
+
+func (matcher *testMatcher) stop() {
+	defer matcher.m.Unlock()
+	matcher.m.Lock()
+
+	if matcher.grace != nil {
+		matcher.grace.Stop()
+	}
+}
+
+func (matcher *testMatcher) Result() *TestResult {
+	defer matcher.m.Unlock()
+	matcher.m.Lock()
+
+	return matcher.result
+}
+
+func compileRegexps(expressions []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+
+	for _, expression := range expressions {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, err
+		}
+
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
+func (runner *Runner) GetTest() *RunnerTest {
+	test := &RunnerTest{}
+
+	if runner.Test != nil {
+		*test = *runner.Test
+	}
+
+	if len(test.Failure) == 0 {
+		test.Failure = defaultTestFailures
+	}
+
+	if test.Timeout == 0 {
+		test.Timeout = DefaultTestTimeout
+	}
+
+	if test.Log == "" {
+		test.Log = util.WDProject(runner.project, "logs", runner.name+".log")
+	}
+
+	return test
+}
+
+func (runner *Runner) RunTest(ctx context.Context, stdout io.Writer) (*TestResult, error) {
+	test := runner.GetTest()
+
+	success, err := compileRegexps(test.Success)
+	if err != nil {
+		return nil, err
+	}
+
+	failure, err := compileRegexps(test.Failure)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(path.Dir(test.Log), 0750); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(test.Log)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	ctx, cancelTimeout := context.WithTimeout(ctx, test.Timeout)
+	defer cancelTimeout()
+
+	matcher := &testMatcher{
+		cancel:  cancel,
+		success: success,
+		failure: failure,
+	}
+
+	defer matcher.stop()
+
+	parser := crash.NewParser()
+
+	writers := []io.Writer{file, matcher, parser}
+	if stdout != nil {
+		writers = append(writers, stdout)
+	}
+
+	var stdin io.Reader
+
+	if len(runner.Script) > 0 {
+		reader, input, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+
+		defer reader.Close()
+		defer input.Close()
+
+		session := expect.New(input)
+		defer session.Close()
+
+		writers = append(writers, session)
+		stdin = reader
+
+		go func() {
+			if err := session.Run(ctx, runner.Script); err != nil {
+				matcher.finish(&TestResult{Reason: "script failed", Err: err})
+				return
+			}
+
+			matcher.finish(&TestResult{Passed: true, Reason: "script completed"})
+		}()
+	}
+
+	writer := io.MultiWriter(writers...)
+
+	headless := *runner
+	headless.Graphic = false
+
+	start := time.Now()
+	err = headless.Execute(ctx, stdin, writer, writer)
+
+	result := matcher.Result()
+
+	switch {
+	case result != nil:
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result = &TestResult{Reason: "timeout after " + test.Timeout.String()}
+	case err != nil:
+		result = &TestResult{Reason: "runner exited with error", Err: err}
+	case len(runner.Script) > 0:
+		result = &TestResult{Reason: "runner exited before script completed"}
+	case len(success) > 0:
+		result = &TestResult{Reason: "runner exited without success marker"}
+	default:
+		result = &TestResult{Passed: true, Reason: "runner exited successfully"}
+	}
+
+	result.Log = test.Log
+	result.Duration = time.Since(start)
+	result.Crashes = parser.Reports()
+
+	return result, nil
+}
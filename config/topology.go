@@ -0,0 +1,545 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Dviih/golinux/util"
+	"hash/fnv"
+	"io"
+	"net/netip"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTopologyMulticast     = "230.0.0.1"
+	DefaultTopologyMulticastPort = 20000
+	DefaultTopologyPort          = 10000
+	DefaultTopologySubnet        = "10.0.3.0/24"
+)
+
+type TopologyNetwork struct {
+	Mode      string `yaml:"mode"`
+	Multicast string `yaml:"multicast"`
+	Port      int    `yaml:"port"`
+	Bridge    string `yaml:"bridge"`
+	Subnet    string `yaml:"subnet"`
+}
+
+type Node struct {
+	name   string   `yaml:"-"`
+	runner *Runner  `yaml:"-"`
+	pkg    *Package `yaml:"-"`
+
+	Runner  string `yaml:"runner"`
+	Kernel  string `yaml:"kernel"`
+	Package string `yaml:"package"`
+	Address string `yaml:"address"`
+	MAC     string `yaml:"mac"`
+}
+
+type Topology struct {
+	name    string `yaml:"-"`
+	project string `yaml:"-"`
+
+	Network *TopologyNetwork `yaml:"network"`
+	Nodes   map[string]*Node `yaml:"nodes"`
+}
+
+func (config *Config) Topology(name string) *Topology {
+	topology, ok := config.Topologies[name]
+	if !ok {
+		return &Topology{name: name, project: config.Project}
+	}
+
+	topology.name = name
+	topology.project = config.Project
+
+	for name, node := range topology.Nodes {
+		runner := *config.Runner(node.Runner)
+
+		if node.Kernel != "" {
+			runner.kernel = config.Kernel(node.Kernel)
+		}
+
+		node.name = name
+		node.runner = &runner
+
+		if node.Package != "" {
+			node.pkg = config.Package(node.Package)
+		}
+	}
+
+	return topology
+}
+
+func (config *Config) topologyKernelOptions(name string) map[string]string {
+	options := make(map[string]string)
+
+	for _, topology := range config.Topologies {
+		for _, node := range topology.Nodes {
+			runner, ok := config.Runners[node.Runner]
+			if !ok {
+				continue
+			}
+
+			kernel := node.Kernel
+			if kernel == "" {
+				kernel = runner.Kernel
+			}
+
+			if kernel == "" {
+				kernel = config.UseKernel
+			}
+
+			if kernel != name {
+				continue
+			}
+
+			copied := *runner
+			copied.Network = &Network{Mode: topology.GetNetwork().GetMode()}
+
+			for option, value := range copied.KernelOptions() {
+				options[option] = value
+			}
+		}
+	}
+
+	return options
+}
+
+func (topology *Topology) Name() string {
+	return topology.name
+}
+
+func (topology *Topology) GetNetwork() *TopologyNetwork {
+	if topology.Network == nil {
+		return &TopologyNetwork{}
+	}
+
+	return topology.Network
+}
+
+func (network *TopologyNetwork) GetMode() string {
+	if network.Mode == "" {
+		return NetworkModeMulticast
+	}
+
+	return network.Mode
+}
+
+func (topology *Topology) Names() []string {
+	var names []string
+
+	for name := range topology.Nodes {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+	return names
+}
+
+func (topology *Topology) Instance(node string) *Instance {
+	return &Instance{name: topology.name + "-" + node, project: topology.project}
+}
+
+func (topology *Topology) Instances() []*Instance {
+	var instances []*Instance
+
+	for _, name := range topology.Names() {
+		instances = append(instances, topology.Instance(name))
+	}
+
+	return instances
+}
+
+func (topology *Topology) address(node *Node, index int) (string, error) {
+	if node.Address != "" {
+		return node.Address, nil
+	}
+
+	subnet := topology.GetNetwork().Subnet
+	if subnet == "" {
+		subnet = DefaultTopologySubnet
+	}
+
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return "", err
+	}
+
+	address := prefix.Masked().Addr()
+
+	for i := 0; i <= index; i++ {
+		address = address.Next()
+	}
+
+	if !prefix.Contains(address) {
+		return "", errors.New("subnet " + subnet + " is too small for topology " + topology.name)
+	}
+
+	return netip.PrefixFrom(address, prefix.Bits()).String(), nil
+}
+
+func (topology *Topology) mac(node *Node, index int) string {
+	if node.MAC != "" {
+		return node.MAC
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(topology.name))
+
+	sum := hash.Sum32()
+	return fmt.Sprintf("52:54:00:%02x:%02x:%02x", byte(sum>>8), byte(sum), byte(index+1))
+}
+
+// multicast derives the default group port from the topology, topologies that
+// share a host would otherwise join each other's segment.
+func (topology *Topology) multicast() string {
+	hash := fnv.New32a()
+	hash.Write([]byte(topology.project + "/" + topology.name))
+
+	return DefaultTopologyMulticast + ":" + strconv.Itoa(DefaultTopologyMulticastPort+int(hash.Sum32()%10000))
+}
+
+func (topology *Topology) runner(ctx context.Context, index int, name string) (*Runner, error) {
+	node := topology.Nodes[name]
+	if node.runner == nil || node.runner.Name() == "" {
+		return nil, errors.New("node " + name + " has an invalid runner: " + node.Runner)
+	}
+
+	runner := *node.runner
+
+	// every node is its own VM, a shared guest cid would keep all but one from starting.
+	if runner.Vsock != nil && runner.Vsock.CID >= 3 {
+		vsock := *runner.Vsock
+		vsock.CID += uint32(index)
+		runner.Vsock = &vsock
+	}
+
+	runner.instance = topology.Instance(name).Name()
+
+	address, err := topology.address(node, index)
+	if err != nil {
+		return nil, err
+	}
+
+	network := topology.GetNetwork()
+
+	runner.Network = &Network{
+		Mode:    network.GetMode(),
+		MAC:     topology.mac(node, index),
+		Address: address,
+		Bridge:  network.Bridge,
+	}
+
+	switch runner.Network.Mode {
+	case NetworkModeMulticast:
+		runner.Network.Multicast = network.Multicast
+		if runner.Network.Multicast == "" {
+			runner.Network.Multicast = topology.multicast()
+		}
+	case NetworkModeSocket:
+		if len(topology.Nodes) != 2 {
+			return nil, errors.New("socket topology requires exactly two nodes")
+		}
+
+		port := network.Port
+		if port == 0 {
+			port = DefaultTopologyPort
+		}
+
+		if index == 0 {
+			runner.Network.Listen = "127.0.0.1:" + strconv.Itoa(port)
+		} else {
+			runner.Network.Connect = "127.0.0.1:" + strconv.Itoa(port)
+		}
+	case NetworkModeBridge:
+	default:
+		return nil, errors.New("invalid topology network mode: " + runner.Network.Mode)
+	}
+
+	if node.pkg != nil {
+		initramfs, err := topology.initramfs(ctx, &runner, node)
+		if err != nil {
+			return nil, err
+		}
+
+		runner.Initramfs = initramfs
+	}
+
+	return &runner, nil
+}
+
+func (topology *Topology) initramfs(ctx context.Context, runner *Runner, node *Node) (string, error) {
+	if node.pkg.IsModule() {
+		return "", errors.New("node " + node.name + " cannot use module package " + node.pkg.Name())
+	}
+
+	root := util.WDProject(topology.project, "topology", topology.name, node.name, "initramfs")
+
+	if err := os.RemoveAll(root); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(root, 0750); err != nil {
+		return "", err
+	}
+
+	file, err := os.OpenFile(path.Join(root, "init"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	if err = node.pkg.Build(ctx, file); err != nil {
+		file.Close()
+		return "", err
+	}
+
+	if err = file.Close(); err != nil {
+		return "", err
+	}
+
+	base, err := runner.InitramfsArchive()
+	if err != nil {
+		return "", err
+	}
+
+	archive := path.Join(path.Dir(root), "initramfs.cpio")
+
+	if err = util.CopyFile(archive, base); err != nil {
+		return "", err
+	}
+
+	// the kernel unpacks concatenated archives in order, so the node's /init
+	// replaces the one from the project initramfs and everything else is kept.
+	if file, err = os.OpenFile(archive, os.O_WRONLY|os.O_APPEND, 0); err != nil {
+		return "", err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return "", err
+	}
+
+	if n := stat.Size() % 4; n != 0 {
+		if _, err = file.Write(make([]byte, 4-n)); err != nil {
+			file.Close()
+			return "", err
+		}
+	}
+
+	cpio := util.NewCPIO(file)
+
+	if err = cpio.AddDirectory(root, ""); err != nil {
+		file.Close()
+		return "", err
+	}
+
+	if err = cpio.Close(); err != nil {
+		file.Close()
+		return "", err
+	}
+
+	if err = file.Close(); err != nil {
+		return "", err
+	}
+
+	return archive, nil
+}
+
+func (topology *Topology) kernels(ctx context.Context) error {
+	built := make(map[string]bool)
+
+	for _, name := range topology.Names() {
+		node := topology.Nodes[name]
+		if node.Kernel == "" || built[node.Kernel] || node.runner == nil {
+			continue
+		}
+
+		kernel := node.runner.GetKernel()
+		if kernel.Path == "" {
+			return errors.New("node " + name + " has an invalid kernel: " + node.Kernel)
+		}
+
+		if err := kernel.Build(ctx, nil); err != nil {
+			return errors.New("node " + name + ": " + err.Error())
+		}
+
+		built[node.Kernel] = true
+	}
+
+	return nil
+}
+
+func (topology *Topology) Up(ctx context.Context) ([]*Instance, error) {
+	if len(topology.Nodes) == 0 {
+		return nil, errors.New("topology " + topology.name + " has no nodes")
+	}
+
+	if err := topology.kernels(ctx); err != nil {
+		return nil, err
+	}
+
+	var instances []*Instance
+
+	for index, name := range topology.Names() {
+		runner, err := topology.runner(ctx, index, name)
+		if err == nil {
+			var instance *Instance
+
+			if instance, err = runner.Up(ctx, topology.Instance(name).Name()); err == nil {
+				instances = append(instances, instance)
+				continue
+			}
+		}
+
+		for _, instance := range instances {
+			_ = instance.Down(ctx, DefaultDownTimeout)
+		}
+
+		return nil, errors.New("node " + name + ": " + err.Error())
+	}
+
+	return instances, nil
+}
+
+func (topology *Topology) Down(ctx context.Context, timeout time.Duration) error {
+	instances := topology.Instances()
+	errs := make([]error, len(instances))
+
+	var wg sync.WaitGroup
+
+	for i, instance := range instances {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			errs[i] = instance.Down(ctx, timeout)
+		}()
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (topology *Topology) Logs(ctx context.Context, writer io.Writer, follow bool) error {
+	instances := topology.Instances()
+	errs := make([]error, len(instances))
+
+	width := 0
+	for _, name := range topology.Names() {
+		width = max(width, len(name))
+	}
+
+	var (
+		m  sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for i, name := range topology.Names() {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			prefix := fmt.Sprintf("%-*s | ", width, name)
+
+			errs[i] = tail(ctx, instances[i].Log(), follow, func(line string) {
+				defer m.Unlock()
+				m.Lock()
+
+				io.WriteString(writer, prefix+line)
+			})
+		}()
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func tail(ctx context.Context, name string, follow bool, handler func(string)) error {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	var file *os.File
+
+	for file == nil {
+		f, err := os.Open(name)
+		if err == nil {
+			file = f
+			break
+		}
+
+		if !follow || !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	partial := ""
+
+	for {
+		line, err := reader.ReadString('\n')
+		partial += line
+
+		if err == nil {
+			handler(partial)
+			partial = ""
+
+			continue
+		}
+
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if !follow {
+			if partial != "" {
+				handler(partial + "\n")
+			}
+
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,290 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package config
+
+import (
+	"context"
+	"debug/pe"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var ukiStubs = map[string]string{
+	"amd64":   "x64",
+	"386":     "ia32",
+	"arm64":   "aa64",
+	"arm":     "arm",
+	"riscv64": "riscv64",
+}
+
+type KernelUKI struct {
+	Arch      string   `yaml:"arch"`
+	Stub      string   `yaml:"stub"`
+	Cmdline   []string `yaml:"cmdline"`
+	Initramfs string   `yaml:"initramfs"`
+	OSRelease string   `yaml:"os_release"`
+	Splash    string   `yaml:"splash"`
+	Key       string   `yaml:"key"`
+	Cert      string   `yaml:"cert"`
+}
+
+type ukiSection struct {
+	name string
+	path string
+}
+
+func wdPath(name string) string {
+	if name == "" || name[0] == '/' {
+		return name
+	}
+
+	return util.WD(name)
+}
+
+func (kernel *Kernel) GetUKI() *KernelUKI {
+	if kernel.UKI == nil {
+		return &KernelUKI{}
+	}
+
+	return kernel.UKI
+}
+
+func (kernel *Kernel) UKIArch() (string, error) {
+	name := strings.ToLower(kernel.GetUKI().Arch)
+	if name == "" {
+		return kernel.Arch()
+	}
+
+	if alias, ok := archAliases[name]; ok {
+		return alias, nil
+	}
+
+	return name, nil
+}
+
+func (uki *KernelUKI) GetStub(arch string) (string, error) {
+	if uki.Stub != "" {
+		return wdPath(uki.Stub), nil
+	}
+
+	name, ok := ukiStubs[arch]
+	if !ok {
+		return "", errors.New("no uki stub for arch " + arch)
+	}
+
+	return "/usr/lib/systemd/boot/efi/linux" + name + ".efi.stub", nil
+}
+
+func (kernel *Kernel) UKIPath() string {
+	return util.WDProject(kernel.compiler.project, "uki", kernel.Name()+".efi")
+}
+
+func (kernel *Kernel) BuildUKI(ctx context.Context) (string, error) {
+	uki := kernel.GetUKI()
+
+	name, err := kernel.UKIArch()
+	if err != nil {
+		return "", err
+	}
+
+	arch, ok := archs[name]
+	if !ok {
+		return "", errors.New("unsupported arch: " + name)
+	}
+
+	cmdline := uki.Cmdline
+	if len(cmdline) == 0 {
+		cmdline = kernel.GetCmdline()
+	}
+
+	output := kernel.UKIPath()
+	return output, kernel.uki(ctx, name, path.Join(kernel.Path, arch.Image), wdPath(uki.Initramfs), cmdline, output)
+}
+
+func (kernel *Kernel) osRelease(staging string) (string, error) {
+	if name := kernel.GetUKI().OSRelease; name != "" {
+		return wdPath(name), nil
+	}
+
+	release, err := kernel.Release()
+	if err != nil {
+		return "", err
+	}
+
+	project := ""
+	if kernel.compiler != nil {
+		project = kernel.compiler.project
+	}
+
+	name := path.Join(staging, "os-release")
+	data := "NAME=\"golinux\"\nID=golinux\nPRETTY_NAME=\"golinux " + project + "\"\nVERSION_ID=\"" + release + "\"\n"
+
+	return name, os.WriteFile(name, []byte(data), 0644)
+}
+
+func (kernel *Kernel) uki(ctx context.Context, arch, image, initramfs string, cmdline []string, output string) error {
+	uki := kernel.GetUKI()
+
+	if (uki.Key == "") != (uki.Cert == "") {
+		return errors.New("signing the uki of kernel " + kernel.Name() + " requires both key and cert")
+	}
+
+	stub, err := uki.GetStub(arch)
+	if err != nil {
+		return err
+	}
+
+	staging := output + ".d"
+
+	if err = os.MkdirAll(staging, 0750); err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(staging)
+
+	osRelease, err := kernel.osRelease(staging)
+	if err != nil {
+		return err
+	}
+
+	sections := []*ukiSection{{name: ".osrel", path: osRelease}}
+
+	if len(cmdline) > 0 {
+		name := path.Join(staging, "cmdline")
+
+		if err = os.WriteFile(name, []byte(strings.Join(cmdline, " ")), 0644); err != nil {
+			return err
+		}
+
+		sections = append(sections, &ukiSection{name: ".cmdline", path: name})
+	}
+
+	if uki.Splash != "" {
+		sections = append(sections, &ukiSection{name: ".splash", path: wdPath(uki.Splash)})
+	}
+
+	if initramfs != "" {
+		sections = append(sections, &ukiSection{name: ".initrd", path: initramfs})
+	}
+
+	sections = append(sections, &ukiSection{name: ".linux", path: image})
+
+	if _, err = exec.LookPath("ukify"); err == nil {
+		return ukify(ctx, stub, sections, uki.Key, uki.Cert, output)
+	}
+
+	if err = objcopy(ctx, stub, sections, output); err != nil {
+		return err
+	}
+
+	if uki.Key == "" {
+		return nil
+	}
+
+	signed := output + ".signed"
+
+	if err = run(ctx, "sbsign", "--key", wdPath(uki.Key), "--cert", wdPath(uki.Cert), "--output", signed, output); err != nil {
+		return err
+	}
+
+	return os.Rename(signed, output)
+}
+
+func ukify(ctx context.Context, stub string, sections []*ukiSection, key, cert, output string) error {
+	args := []string{"build", "--stub=" + stub, "--output=" + output}
+
+	for _, section := range sections {
+		switch section.name {
+		case ".linux":
+			args = append(args, "--linux="+section.path)
+		case ".initrd":
+			args = append(args, "--initrd="+section.path)
+		case ".cmdline":
+			args = append(args, "--cmdline=@"+section.path)
+		case ".osrel":
+			args = append(args, "--os-release=@"+section.path)
+		case ".splash":
+			args = append(args, "--splash="+section.path)
+		}
+	}
+
+	if key != "" {
+		args = append(args, "--secureboot-private-key="+wdPath(key), "--secureboot-certificate="+wdPath(cert))
+	}
+
+	return run(ctx, "ukify", args...)
+}
+
+func objcopy(ctx context.Context, stub string, sections []*ukiSection, output string) error {
+	file, err := pe.Open(stub)
+	if err != nil {
+		return err
+	}
+
+	var base, alignment, end uint64
+
+	switch header := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader64:
+		base, alignment = header.ImageBase, uint64(header.SectionAlignment)
+	case *pe.OptionalHeader32:
+		base, alignment = uint64(header.ImageBase), uint64(header.SectionAlignment)
+	default:
+		file.Close()
+		return errors.New("invalid stub: " + stub)
+	}
+
+	for _, section := range file.Sections {
+		end = max(end, uint64(section.VirtualAddress)+uint64(section.VirtualSize))
+	}
+
+	file.Close()
+
+	align := func(n uint64) uint64 {
+		return (n + alignment - 1) &^ (alignment - 1)
+	}
+
+	var args []string
+	offset := align(end)
+
+	for _, section := range sections {
+		stat, err := os.Stat(section.path)
+		if err != nil {
+			return err
+		}
+
+		args = append(args,
+			"--add-section", section.name+"="+section.path,
+			"--change-section-vma", section.name+"=0x"+strconv.FormatUint(base+offset, 16),
+		)
+
+		offset = align(offset + uint64(stat.Size()))
+	}
+
+	if err = os.MkdirAll(path.Dir(output), 0750); err != nil {
+		return err
+	}
+
+	return run(ctx, "objcopy", append(args, stub, output)...)
+}
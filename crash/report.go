@@ -0,0 +1,398 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package crash
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const maxLines = 1024
+
+type Kind int
+
+const (
+	KindPanic Kind = iota
+	KindOops
+	KindBUG
+	KindWarning
+	KindInit
+	KindGo
+)
+
+func (kind Kind) String() string {
+	switch kind {
+	case KindPanic:
+		return "kernel panic"
+	case KindOops:
+		return "oops"
+	case KindBUG:
+		return "bug"
+	case KindWarning:
+		return "warning"
+	case KindInit:
+		return "init crash"
+	case KindGo:
+		return "go panic"
+	default:
+		return "unknown"
+	}
+}
+
+type Frame struct {
+	Symbol     string
+	Offset     uint64
+	Size       uint64
+	Module     string
+	Address    uint64
+	Unreliable bool
+	Source     string
+	Inlined    []string
+}
+
+func (frame *Frame) String() string {
+	var builder strings.Builder
+
+	if frame.Unreliable {
+		builder.WriteString("? ")
+	}
+
+	builder.WriteString(frame.Symbol)
+
+	if frame.Size != 0 {
+		builder.WriteString("+0x" + strconv.FormatUint(frame.Offset, 16) + "/0x" + strconv.FormatUint(frame.Size, 16))
+	}
+
+	if frame.Module != "" {
+		builder.WriteString(" [" + frame.Module + "]")
+	}
+
+	if frame.Source != "" {
+		builder.WriteString(" " + frame.Source)
+	}
+
+	for _, inlined := range frame.Inlined {
+		builder.WriteString("\n      inlined by " + inlined)
+	}
+
+	return builder.String()
+}
+
+type Goroutine struct {
+	ID     int
+	State  string
+	Frames []*Frame
+}
+
+type Report struct {
+	Kind       Kind
+	Reason     string
+	Location   string
+	CallTrace  []*Frame
+	Registers  map[string]string
+	Goroutines []*Goroutine
+	Lines      []string
+	Decoded    []string
+}
+
+func (report *Report) String() string {
+	var builder strings.Builder
+
+	builder.WriteString(report.Kind.String() + ": " + report.Reason + "\n")
+
+	if report.Location != "" {
+		builder.WriteString("  at " + report.Location + "\n")
+	}
+
+	if len(report.Decoded) > 0 {
+		for _, line := range report.Decoded {
+			builder.WriteString("  " + line + "\n")
+		}
+
+		return builder.String()
+	}
+
+	if len(report.CallTrace) > 0 {
+		builder.WriteString("  call trace:\n")
+
+		for _, frame := range report.CallTrace {
+			builder.WriteString("    " + frame.String() + "\n")
+		}
+	}
+
+	for _, goroutine := range report.Goroutines {
+		builder.WriteString("  goroutine " + strconv.Itoa(goroutine.ID) + " [" + goroutine.State + "]:\n")
+
+		for _, frame := range goroutine.Frames {
+			builder.WriteString("    " + frame.String() + "\n")
+		}
+	}
+
+	return builder.String()
+}
+
+var (
+	printkPrefix = regexp.MustCompile(`^\[\s*\d+\.\d+\]\s?`)
+
+	kernelPanic   = regexp.MustCompile(`Kernel panic - not syncing: (.*)$`)
+	kernelOops    = regexp.MustCompile(`^(?:Internal error: )?Oops(?::| -) ?(.*)$`)
+	kernelBUG     = regexp.MustCompile(`(?:^|\s)(?:BUG: (.*)|kernel BUG at (.*)!)`)
+	kernelWarning = regexp.MustCompile(`WARNING: CPU: \d+ PID: \d+ at (\S+) ?(.*)$`)
+	kernelEnd     = regexp.MustCompile(`---\[ end `)
+
+	traceStart = regexp.MustCompile(`^\s*Call [Tt]race:`)
+	traceFrame = regexp.MustCompile(`^\s*(?:\[<([0-9a-f]+)>\] )?(\? )?([\w.$]+)\+0x([0-9a-f]+)/0x([0-9a-f]+)(?: \[([\w-]+)\])?`)
+	traceMark  = regexp.MustCompile(`^\s*</?(?:TASK|IRQ|NMI|SOFTIRQ|EOI)>`)
+
+	registerPC   = regexp.MustCompile(`^\s*(RIP|EIP|pc|lr|epc|ra)\s*:\s*(?:[0-9a-f]{4}:)?(\S+)`)
+	registerPair = regexp.MustCompile(`\b([A-Za-z][A-Za-z0-9]{0,3})\s?:\s?([0-9a-f]{8,16})\b`)
+
+	goPanic     = regexp.MustCompile(`^(?:panic|fatal error): (.*)$`)
+	goGoroutine = regexp.MustCompile(`^goroutine (\d+) \[([^\]]*)\]:$`)
+	goFunction  = regexp.MustCompile(`^(?:created by )?(\S+?)(?:\(.*\))?(?: in goroutine \d+)?$`)
+	goSource    = regexp.MustCompile(`^\t(\S+:\d+)(?: \+0x[0-9a-f]+)?$`)
+)
+
+type Parser struct {
+	m       sync.Mutex
+	line    []byte
+	reports []*Report
+	current *Report
+	trace   bool
+}
+
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+func Parse(text string) []*Report {
+	parser := NewParser()
+	parser.Write([]byte(text))
+
+	return parser.Reports()
+}
+
+func (parser *Parser) Write(data []byte) (int, error) {
+	defer parser.m.Unlock()
+	parser.m.Lock()
+
+	for _, b := range data {
+		if b != '\n' {
+			parser.line = append(parser.line, b)
+			continue
+		}
+
+		parser.feed(strings.TrimRight(string(parser.line), "\r"))
+		parser.line = parser.line[:0]
+	}
+
+	return len(data), nil
+}
+
+func (parser *Parser) Reports() []*Report {
+	defer parser.m.Unlock()
+	parser.m.Lock()
+
+	if len(parser.line) > 0 {
+		parser.feed(strings.TrimRight(string(parser.line), "\r"))
+		parser.line = parser.line[:0]
+	}
+
+	parser.finish()
+	return parser.reports
+}
+
+func (parser *Parser) finish() {
+	if parser.current == nil {
+		return
+	}
+
+	parser.reports = append(parser.reports, parser.current)
+	parser.current = nil
+	parser.trace = false
+}
+
+func (parser *Parser) feed(line string) {
+	text := printkPrefix.ReplaceAllString(line, "")
+
+	if parser.current != nil {
+		if parser.current.Kind == KindGo {
+			if parser.golang(line) {
+				return
+			}
+
+			parser.finish()
+		} else {
+			// a Go panic ends a kernel report that never printed its end marker.
+			golang := goPanic.MatchString(line) || goGoroutine.MatchString(line)
+
+			if !golang && (!kernelPanic.MatchString(text) || kernelEnd.MatchString(text)) {
+				parser.kernel(line, text)
+				return
+			}
+
+			parser.finish()
+		}
+	}
+
+	parser.start(line, text)
+}
+
+func (parser *Parser) start(line, text string) {
+	if kernelEnd.MatchString(text) {
+		return
+	}
+
+	report := &Report{Registers: make(map[string]string)}
+
+	if match := kernelPanic.FindStringSubmatch(text); match != nil {
+		report.Kind = KindPanic
+		report.Reason = match[1]
+
+		if strings.Contains(match[1], "Attempted to kill init") {
+			report.Kind = KindInit
+		}
+	} else if match := kernelWarning.FindStringSubmatch(text); match != nil {
+		report.Kind = KindWarning
+		report.Location = match[1]
+		report.Reason = match[2]
+	} else if match := kernelBUG.FindStringSubmatch(text); match != nil {
+		report.Kind = KindBUG
+		report.Reason = match[1]
+
+		if match[2] != "" {
+			report.Reason = "kernel BUG"
+			report.Location = match[2]
+		}
+	} else if match := kernelOops.FindStringSubmatch(text); match != nil {
+		report.Kind = KindOops
+		report.Reason = match[1]
+	} else if match := goPanic.FindStringSubmatch(line); match != nil {
+		report.Kind = KindGo
+		report.Reason = match[1]
+	} else {
+		return
+	}
+
+	report.Lines = append(report.Lines, line)
+	parser.current = report
+
+	if report.Kind == KindPanic || report.Kind == KindInit {
+		parser.kernel("", "")
+	}
+}
+
+func (parser *Parser) kernel(line, text string) {
+	report := parser.current
+
+	if line != "" {
+		report.Lines = append(report.Lines, line)
+	}
+
+	if kernelEnd.MatchString(text) || len(report.Lines) >= maxLines {
+		parser.finish()
+		return
+	}
+
+	if report.Kind == KindBUG {
+		if match := kernelOops.FindStringSubmatch(text); match != nil {
+			report.Kind = KindOops
+		}
+	}
+
+	if traceStart.MatchString(text) {
+		parser.trace = true
+		return
+	}
+
+	if match := traceFrame.FindStringSubmatch(text); parser.trace && match != nil {
+		frame := &Frame{
+			Unreliable: match[2] != "",
+			Symbol:     match[3],
+			Module:     match[6],
+		}
+
+		frame.Address, _ = strconv.ParseUint(match[1], 16, 64)
+		frame.Offset, _ = strconv.ParseUint(match[4], 16, 64)
+		frame.Size, _ = strconv.ParseUint(match[5], 16, 64)
+
+		report.CallTrace = append(report.CallTrace, frame)
+		return
+	}
+
+	if parser.trace && !traceMark.MatchString(text) {
+		parser.trace = false
+	}
+
+	if match := registerPC.FindStringSubmatch(text); match != nil {
+		report.Registers[match[1]] = match[2]
+
+		if report.Location == "" {
+			report.Location = match[2]
+		}
+
+		return
+	}
+
+	if pairs := registerPair.FindAllStringSubmatch(text, -1); len(pairs) >= 2 {
+		for _, pair := range pairs {
+			report.Registers[pair[1]] = pair[2]
+		}
+	}
+}
+
+func (parser *Parser) golang(line string) bool {
+	report := parser.current
+
+	var goroutine *Goroutine
+	if len(report.Goroutines) > 0 {
+		goroutine = report.Goroutines[len(report.Goroutines)-1]
+	}
+
+	switch {
+	case line == "":
+	case goroutine == nil && (strings.HasPrefix(line, "[") || strings.HasPrefix(line, "panic: ") || strings.HasPrefix(line, "\t")):
+	case goGoroutine.MatchString(line):
+		match := goGoroutine.FindStringSubmatch(line)
+		id, _ := strconv.Atoi(match[1])
+
+		report.Goroutines = append(report.Goroutines, &Goroutine{ID: id, State: match[2]})
+	case goroutine != nil && goSource.MatchString(line):
+		if len(goroutine.Frames) == 0 {
+			return false
+		}
+
+		frame := goroutine.Frames[len(goroutine.Frames)-1]
+		frame.Source = goSource.FindStringSubmatch(line)[1]
+
+		if report.Location == "" {
+			report.Location = frame.Source
+		}
+	case goroutine != nil && goFunction.MatchString(line) && (strings.Contains(line, "(") || strings.HasPrefix(line, "created by ")):
+		goroutine.Frames = append(goroutine.Frames, &Frame{Symbol: goFunction.FindStringSubmatch(line)[1]})
+	default:
+		return false
+	}
+
+	report.Lines = append(report.Lines, line)
+	return len(report.Lines) < maxLines
+}
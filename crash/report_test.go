@@ -0,0 +1,194 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package crash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type expected struct {
+	kind       Kind
+	reason     string
+	location   string
+	frames     int
+	first      string
+	goroutines int
+}
+
+var reportTests = []struct {
+	file    string
+	reports []expected
+}{
+	{
+		file: "oops_x86_64.log",
+		reports: []expected{
+			{kind: KindOops, reason: "kernel NULL pointer dereference, address: 0000000000000000", location: "golinux_test_read+0x11/0x30", frames: 9, first: "? __die+0x23/0x70"},
+		},
+	},
+	{
+		file: "oops_arm64.log",
+		reports: []expected{
+			{kind: KindOops, reason: "0000000096000004 [#1] PREEMPT SMP", location: "golinux_test_read+0x8/0x20", frames: 10, first: "golinux_test_read+0x8/0x20 [golinux_test]"},
+		},
+	},
+	{
+		file: "warning_x86_64.log",
+		reports: []expected{
+			{kind: KindWarning, reason: "golinux_test_init+0x15/0x30 [golinux_test]", location: "drivers/misc/golinux_test.c:42", frames: 11, first: "? __warn+0x81/0x130"},
+		},
+	},
+	{
+		file: "panic_init.log",
+		reports: []expected{
+			{kind: KindInit, reason: "Attempted to kill init! exitcode=0x00000100", frames: 7, first: "dump_stack_lvl+0x36/0x50"},
+		},
+	},
+	{
+		file: "go_panic.log",
+		reports: []expected{
+			{kind: KindGo, reason: "runtime error: index out of range [3] with length 3", location: "/src/cmd/init/main.go:27", goroutines: 1},
+			{kind: KindInit, reason: "Attempted to kill init! exitcode=0x00000200", frames: 7, first: "dump_stack_lvl+0x36/0x50"},
+		},
+	},
+	{
+		file: "go_fatal.log",
+		reports: []expected{
+			{kind: KindGo, reason: "all goroutines are asleep - deadlock!", location: "/src/main.go:9", goroutines: 2},
+		},
+	},
+	{
+		file: "warning_then_go.log",
+		reports: []expected{
+			{kind: KindWarning, reason: "__flush_work+0x2ce/0x2e0", location: "kernel/workqueue.c:3344", frames: 6, first: "flush_work+0x10/0x20"},
+			{kind: KindGo, reason: "open /etc/config.yaml: no such file or directory", location: "/src/main.go:20", goroutines: 1},
+		},
+	},
+}
+
+func checkReports(t *testing.T, reports []*Report, expectations []expected) {
+	t.Helper()
+
+	if len(reports) != len(expectations) {
+		for _, report := range reports {
+			t.Log(report)
+		}
+
+		t.Fatalf("got %d reports, want %d", len(reports), len(expectations))
+	}
+
+	for i, want := range expectations {
+		got := reports[i]
+
+		if got.Kind != want.kind {
+			t.Errorf("report %d: kind %s, want %s", i, got.Kind, want.kind)
+		}
+
+		if got.Reason != want.reason {
+			t.Errorf("report %d: reason %q, want %q", i, got.Reason, want.reason)
+		}
+
+		if got.Location != want.location {
+			t.Errorf("report %d: location %q, want %q", i, got.Location, want.location)
+		}
+
+		if len(got.CallTrace) != want.frames {
+			t.Errorf("report %d: %d frames, want %d", i, len(got.CallTrace), want.frames)
+		} else if want.frames > 0 && got.CallTrace[0].String() != want.first {
+			t.Errorf("report %d: first frame %q, want %q", i, got.CallTrace[0].String(), want.first)
+		}
+
+		if len(got.Goroutines) != want.goroutines {
+			t.Errorf("report %d: %d goroutines, want %d", i, len(got.Goroutines), want.goroutines)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range reportTests {
+		t.Run(test.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checkReports(t, Parse(string(data)), test.reports)
+		})
+	}
+}
+
+// TestParserWrites feeds the captures in small chunks, the way console output
+// arrives from a runner.
+func TestParserWrites(t *testing.T) {
+	for _, test := range reportTests {
+		t.Run(test.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parser := NewParser()
+
+			for len(data) > 0 {
+				n := min(7, len(data))
+
+				if _, err = parser.Write(data[:n]); err != nil {
+					t.Fatal(err)
+				}
+
+				data = data[n:]
+			}
+
+			checkReports(t, parser.Reports(), test.reports)
+		})
+	}
+}
+
+func TestGoroutineFrames(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "go_fatal.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports := Parse(string(data))
+	if len(reports) != 1 || len(reports[0].Goroutines) != 2 {
+		t.Fatalf("unexpected reports %v", reports)
+	}
+
+	worker := reports[0].Goroutines[1]
+
+	if worker.ID != 6 || worker.State != "select" {
+		t.Errorf("goroutine %d [%s], want 6 [select]", worker.ID, worker.State)
+	}
+
+	symbols := []string{"main.worker", "main.main"}
+	sources := []string{"/src/worker.go:31", "/src/main.go:8"}
+
+	if len(worker.Frames) != len(symbols) {
+		t.Fatalf("got %d frames, want %d", len(worker.Frames), len(symbols))
+	}
+
+	for i, frame := range worker.Frames {
+		if frame.Symbol != symbols[i] || frame.Source != sources[i] {
+			t.Errorf("frame %d: %s %s, want %s %s", i, frame.Symbol, frame.Source, symbols[i], sources[i])
+		}
+	}
+}
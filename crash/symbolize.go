@@ -0,0 +1,180 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package crash
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"errors"
+	"github.com/Dviih/golinux/util"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type Symbolizer struct {
+	Vmlinux string
+	Source  string
+	Modules string
+
+	symbols map[string]uint64
+}
+
+func NewSymbolizer(vmlinux, source, modules string) *Symbolizer {
+	return &Symbolizer{
+		Vmlinux: vmlinux,
+		Source:  source,
+		Modules: modules,
+	}
+}
+
+func (symbolizer *Symbolizer) Symbolize(ctx context.Context, reports ...*Report) error {
+	if _, err := os.Stat(symbolizer.Vmlinux); err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		if report.Kind == KindGo || len(report.CallTrace) == 0 {
+			continue
+		}
+
+		err := symbolizer.decode(ctx, report)
+		if err == nil {
+			continue
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		if err = symbolizer.addr2line(ctx, report); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (symbolizer *Symbolizer) decode(ctx context.Context, report *Report) error {
+	script := path.Join(symbolizer.Source, "scripts", "decode_stacktrace.sh")
+
+	if _, err := os.Stat(script); symbolizer.Source == "" || err != nil {
+		return os.ErrNotExist
+	}
+
+	args := []string{symbolizer.Vmlinux, symbolizer.Source}
+	if symbolizer.Modules != "" {
+		args = append(args, symbolizer.Modules)
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &util.Writer{}
+
+	cmd := exec.CommandContext(ctx, script, args...)
+	cmd.Stdin = strings.NewReader(strings.Join(report.Lines, "\n") + "\n")
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return stderr.Error(err)
+	}
+
+	report.Decoded = strings.Split(strings.TrimRight(stdout.String(), "\n"), "\n")
+	return nil
+}
+
+func (symbolizer *Symbolizer) load() error {
+	if symbolizer.symbols != nil {
+		return nil
+	}
+
+	file, err := elf.Open(symbolizer.Vmlinux)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	symbols, err := file.Symbols()
+	if err != nil {
+		return err
+	}
+
+	symbolizer.symbols = make(map[string]uint64, len(symbols))
+
+	for _, symbol := range symbols {
+		if elf.ST_TYPE(symbol.Info) == elf.STT_FUNC {
+			symbolizer.symbols[symbol.Name] = symbol.Value
+		}
+	}
+
+	return nil
+}
+
+func (symbolizer *Symbolizer) addr2line(ctx context.Context, report *Report) error {
+	if _, err := exec.LookPath("addr2line"); err != nil {
+		return err
+	}
+
+	if err := symbolizer.load(); err != nil {
+		return err
+	}
+
+	for _, frame := range report.CallTrace {
+		if frame.Module != "" {
+			continue
+		}
+
+		address, ok := symbolizer.symbols[frame.Symbol]
+		if !ok {
+			continue
+		}
+
+		address += frame.Offset
+
+		output, err := exec.CommandContext(ctx, "addr2line", "-e", symbolizer.Vmlinux, "-f", "-i", "-p", "0x"+strconv.FormatUint(address, 16)).Output()
+		if err != nil {
+			return err
+		}
+
+		frame.Address = address
+
+		for i, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			line = strings.TrimPrefix(strings.TrimSpace(line), "(inlined by) ")
+
+			_, source, found := strings.Cut(line, " at ")
+			if !found || strings.HasPrefix(source, "??") {
+				continue
+			}
+
+			if i == 0 {
+				frame.Source = source
+				continue
+			}
+
+			frame.Inlined = append(frame.Inlined, line)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package expect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTimeout = 30 * time.Second
+	maxBuffer      = 1 << 20
+)
+
+var (
+	ErrTimeout = errors.New("expect: timeout")
+	ErrClosed  = errors.New("expect: output closed")
+)
+
+type MatchError struct {
+	Pattern string
+	Output  string
+	Err     error
+}
+
+func (err *MatchError) Error() string {
+	return "expect: " + strings.TrimPrefix(err.Err.Error(), "expect: ") + " waiting for " + strconv.Quote(err.Pattern)
+}
+
+func (err *MatchError) Unwrap() error {
+	return err.Err
+}
+
+type Session struct {
+	m      sync.Mutex
+	buffer []byte
+	notify chan struct{}
+	err    error
+
+	input   io.Writer
+	Timeout time.Duration
+}
+
+func New(input io.Writer) *Session {
+	return &Session{
+		notify:  make(chan struct{}),
+		input:   input,
+		Timeout: DefaultTimeout,
+	}
+}
+
+func (session *Session) Write(data []byte) (int, error) {
+	defer session.m.Unlock()
+	session.m.Lock()
+
+	if session.err != nil {
+		return 0, session.err
+	}
+
+	session.buffer = append(session.buffer, data...)
+	if len(session.buffer) > maxBuffer {
+		session.buffer = session.buffer[len(session.buffer)-maxBuffer:]
+	}
+
+	session.wake()
+	return len(data), nil
+}
+
+func (session *Session) Close() error {
+	return session.CloseWithError(nil)
+}
+
+func (session *Session) CloseWithError(err error) error {
+	defer session.m.Unlock()
+	session.m.Lock()
+
+	if session.err != nil {
+		return nil
+	}
+
+	if err == nil {
+		err = ErrClosed
+	}
+
+	session.err = err
+	session.wake()
+
+	return nil
+}
+
+func (session *Session) wake() {
+	close(session.notify)
+	session.notify = make(chan struct{})
+}
+
+func (session *Session) Output() string {
+	defer session.m.Unlock()
+	session.m.Lock()
+
+	return string(session.buffer)
+}
+
+func (session *Session) Expect(ctx context.Context, re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	if timeout <= 0 {
+		timeout = session.Timeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		session.m.Lock()
+
+		if location := re.FindSubmatchIndex(session.buffer); location != nil {
+			match := make([]string, len(location)/2)
+
+			for i := range match {
+				if location[2*i] >= 0 {
+					match[i] = string(session.buffer[location[2*i]:location[2*i+1]])
+				}
+			}
+
+			session.buffer = session.buffer[location[1]:]
+			session.m.Unlock()
+
+			return match, nil
+		}
+
+		notify, err := session.notify, session.err
+		output := string(session.buffer)
+
+		session.m.Unlock()
+
+		if err != nil {
+			return nil, &MatchError{Pattern: re.String(), Output: output, Err: err}
+		}
+
+		select {
+		case <-notify:
+		case <-timer.C:
+			return nil, &MatchError{Pattern: re.String(), Output: output, Err: ErrTimeout}
+		case <-ctx.Done():
+			return nil, &MatchError{Pattern: re.String(), Output: output, Err: ctx.Err()}
+		}
+	}
+}
+
+func (session *Session) ExpectString(ctx context.Context, pattern string, timeout time.Duration) ([]string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return session.Expect(ctx, re, timeout)
+}
+
+func (session *Session) Send(data string) error {
+	if session.input == nil {
+		return errors.New("expect: no input")
+	}
+
+	_, err := io.WriteString(session.input, data)
+	return err
+}
+
+func (session *Session) SendLine(line string) error {
+	return session.Send(line + "\n")
+}
+
+type Step struct {
+	Expect  string        `yaml:"expect"`
+	Send    string        `yaml:"send"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type StepError struct {
+	Step int
+	Err  error
+}
+
+func (err *StepError) Error() string {
+	return "expect: step " + strconv.Itoa(err.Step) + ": " + strings.TrimPrefix(err.Err.Error(), "expect: ")
+}
+
+func (err *StepError) Unwrap() error {
+	return err.Err
+}
+
+func (session *Session) Run(ctx context.Context, steps []*Step) error {
+	for i, step := range steps {
+		if step.Expect != "" {
+			if _, err := session.ExpectString(ctx, step.Expect, step.Timeout); err != nil {
+				return &StepError{Step: i + 1, Err: err}
+			}
+		}
+
+		if step.Send != "" {
+			if err := session.SendLine(step.Send); err != nil {
+				return &StepError{Step: i + 1, Err: err}
+			}
+		}
+	}
+
+	return nil
+}
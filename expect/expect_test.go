@@ -0,0 +1,198 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package expect
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		close  bool
+		steps  []*Step
+		sent   string
+		output string
+		err    error
+	}{
+		{
+			name:   "split match",
+			chunks: []string{"Welcome\nlog", "in", ": "},
+			steps:  []*Step{{Expect: "login: "}},
+		},
+		{
+			name:   "send after match",
+			chunks: []string{"login: ", "Password: ", "# "},
+			steps:  []*Step{{Expect: "login: ", Send: "root"}, {Expect: "Password: ", Send: "secret"}, {Expect: "# "}},
+			sent:   "root\nsecret\n",
+		},
+		{
+			name:   "send without expect",
+			chunks: []string{"$ "},
+			steps:  []*Step{{Send: "echo hi"}, {Expect: `\$ `}},
+			sent:   "echo hi\n",
+		},
+		{
+			name:   "remaining output",
+			chunks: []string{"one two three"},
+			steps:  []*Step{{Expect: "two"}},
+			output: " three",
+		},
+		{
+			name:   "match consumed",
+			chunks: []string{"ready\n"},
+			steps:  []*Step{{Expect: "ready"}, {Expect: "ready", Timeout: 20 * time.Millisecond}},
+			output: "\n",
+			err:    ErrTimeout,
+		},
+		{
+			name:   "timeout",
+			chunks: []string{"booting"},
+			steps:  []*Step{{Expect: "login: ", Timeout: 20 * time.Millisecond}},
+			output: "booting",
+			err:    ErrTimeout,
+		},
+		{
+			name:   "closed",
+			chunks: []string{"Kernel panic"},
+			close:  true,
+			steps:  []*Step{{Expect: "login: "}},
+			output: "Kernel panic",
+			err:    ErrClosed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, guest := io.Pipe()
+			defer guest.Close()
+
+			input, host := io.Pipe()
+
+			session := New(host)
+
+			go func() {
+				_, err := io.Copy(session, output)
+				session.CloseWithError(err)
+			}()
+
+			go func() {
+				for _, chunk := range test.chunks {
+					if _, err := io.WriteString(guest, chunk); err != nil {
+						return
+					}
+				}
+
+				if test.close {
+					guest.Close()
+				}
+			}()
+
+			sent := make(chan string)
+
+			go func() {
+				data, _ := io.ReadAll(input)
+				sent <- string(data)
+			}()
+
+			err := session.Run(context.Background(), test.steps)
+			host.Close()
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+
+			if got := <-sent; got != test.sent {
+				t.Errorf("sent %q, want %q", got, test.sent)
+			}
+
+			if test.err == nil && test.output == "" {
+				return
+			}
+
+			if got := session.Output(); got != test.output {
+				t.Errorf("output %q, want %q", got, test.output)
+			}
+
+			var stepError *StepError
+			if test.err != nil && (!errors.As(err, &stepError) || stepError.Step != len(test.steps)) {
+				t.Errorf("error %v is not from step %d", err, len(test.steps))
+			}
+		})
+	}
+}
+
+func TestBufferTrim(t *testing.T) {
+	session := New(nil)
+
+	chunk := bytes.Repeat([]byte{'x'}, maxBuffer/4)
+
+	for i := 0; i < 6; i++ {
+		if _, err := session.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := session.Write([]byte("tail")); err != nil {
+		t.Fatal(err)
+	}
+
+	output := session.Output()
+
+	if len(output) != maxBuffer {
+		t.Fatalf("buffer holds %d bytes, want %d", len(output), maxBuffer)
+	}
+
+	if !strings.HasSuffix(output, "xtail") {
+		t.Errorf("buffer lost its tail: %q", output[len(output)-8:])
+	}
+
+	match, err := session.ExpectString(context.Background(), "(t)ai(l)", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(match, ",") != "tail,t,l" {
+		t.Errorf("got match %q", match)
+	}
+
+	if session.Output() != "" {
+		t.Errorf("buffer not trimmed after match: %d bytes", len(session.Output()))
+	}
+}
+
+func TestExpectContext(t *testing.T) {
+	session := New(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := session.ExpectString(ctx, "never", time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
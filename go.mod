@@ -5,10 +5,8 @@ go 1.24
 require (
 	github.com/Dviih/logger v1.1.0
 	github.com/fsnotify/fsnotify v1.8.0
+	golang.org/x/sys v0.31.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/Dviih/sync v0.0.0-20250310002416-9365f71e723f // indirect
-	golang.org/x/sys v0.31.0 // indirect
-)
+require github.com/Dviih/sync v0.0.0-20250310002416-9365f71e723f // indirect
@@ -0,0 +1,48 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"os"
+	"strings"
+)
+
+func Cmdline() (map[string]string, error) {
+	var data []byte
+
+	if Container() {
+		data = []byte(os.Getenv("GOLINUX_CMDLINE"))
+	} else {
+		var err error
+
+		if data, err = os.ReadFile("/proc/cmdline"); err != nil {
+			return nil, err
+		}
+	}
+
+	cmdline := make(map[string]string)
+
+	for _, parameter := range strings.Fields(string(data)) {
+		key, value, _ := strings.Cut(parameter, "=")
+		cmdline[key] = value
+	}
+
+	return cmdline, nil
+}
@@ -0,0 +1,57 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+func Console(name string) error {
+	if name == "" {
+		name = "/dev/console"
+	}
+
+	fd, err := unix.Open(name, unix.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	// setsid fails when already a session leader, which PID 1 may be.
+	_, _ = unix.Setsid()
+
+	if err = unix.IoctlSetInt(fd, unix.TIOCSCTTY, 1); err != nil {
+		unix.Close(fd)
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err = unix.Dup2(fd, i); err != nil {
+			unix.Close(fd)
+			return err
+		}
+	}
+
+	if fd > 2 {
+		return unix.Close(fd)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"os"
+	"path"
+)
+
+const containerRootEnv = "GOLINUX_ROOT"
+
+// ContainerDevices are bind-mounted from the host, a user namespace cannot
+// create device nodes itself.
+var ContainerDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+var containerLinks = map[string]string{
+	"ptmx":   "pts/ptmx",
+	"fd":     "/proc/self/fd",
+	"stdin":  "/proc/self/fd/0",
+	"stdout": "/proc/self/fd/1",
+	"stderr": "/proc/self/fd/2",
+}
+
+var ContainerMounts = []*Mount{
+	{Source: "proc", Target: "/proc", Type: "proc", Flags: unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC},
+	{Source: "devpts", Target: "/dev/pts", Type: "devpts", Flags: unix.MS_NOSUID | unix.MS_NOEXEC, Data: "newinstance,ptmxmode=0666"},
+	{Source: "tmpfs", Target: "/dev/shm", Type: "tmpfs", Flags: unix.MS_NOSUID | unix.MS_NODEV, Data: "mode=1777"},
+	{Source: "tmpfs", Target: "/tmp", Type: "tmpfs", Flags: unix.MS_NOSUID | unix.MS_NODEV, Data: "mode=1777"},
+	{Source: "tmpfs", Target: "/run", Type: "tmpfs", Flags: unix.MS_NOSUID | unix.MS_NODEV, Data: "mode=0755"},
+}
+
+func Container() bool {
+	return os.Getenv("container") != ""
+}
+
+// EnterContainer populates /dev of root from the host and makes root the
+// filesystem root, it must run before anything else is mounted.
+func EnterContainer(root string) error {
+	dev := path.Join(root, "dev")
+
+	mount := &Mount{Source: "tmpfs", Target: dev, Type: "tmpfs", Flags: unix.MS_NOSUID, Data: "mode=0755"}
+	if err := mount.Mount(); err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, name := range ContainerDevices {
+		if err := bind(path.Join("/dev", name), path.Join(dev, name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// the console of a container is the terminal it was started on, if any.
+	if console, err := os.Readlink("/proc/self/fd/0"); err == nil && isTerminal(0) {
+		if err = bind(console, path.Join(dev, "console")); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for name, target := range containerLinks {
+		if err := os.Symlink(target, path.Join(dev, name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if err := unix.Chroot(root); err != nil {
+		return &os.PathError{Op: "chroot", Path: root, Err: err}
+	}
+
+	if err := os.Chdir("/"); err != nil {
+		return err
+	}
+
+	return os.Unsetenv(containerRootEnv)
+}
+
+func bind(source, target string) error {
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	if err = unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+		return &os.PathError{Op: "bind " + source, Path: target, Err: err}
+	}
+
+	return nil
+}
+
+func isTerminal(fd int) bool {
+	_, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	return err == nil
+}
@@ -0,0 +1,34 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+const (
+	semihostingExitExtended   = 0x20
+	adpStoppedApplicationExit = 0x20026
+)
+
+// semihostingExit is SYS_EXIT_EXTENDED, the plain SYS_EXIT of AArch32 cannot
+// carry an exit code.
+func semihostingExit(operation uint32, block *[2]uint32)
+
+func exit(code int) error {
+	semihostingExit(semihostingExitExtended, &[2]uint32{adpStoppedApplicationExit, uint32(code)})
+	return nil
+}
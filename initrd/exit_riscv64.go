@@ -0,0 +1,47 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"encoding/binary"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sifiveTest     = 0x100000
+	sifiveTestFail = 0x3333
+)
+
+func exit(code int) error {
+	fd, err := unix.Open("/dev/mem", unix.O_RDWR|unix.O_SYNC, 0)
+	if err != nil {
+		return err
+	}
+
+	defer unix.Close(fd)
+
+	mem, err := unix.Mmap(fd, sifiveTest, unix.Getpagesize(), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(mem, uint32(code)<<16|sifiveTestFail)
+	return unix.Munmap(mem)
+}
@@ -0,0 +1,164 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Dviih/golinux/agent"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/signal"
+	"strconv"
+)
+
+type ExitCode int
+
+func (code ExitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(code))
+}
+
+func Setup(ctx context.Context) error {
+	var errs []error
+
+	container := Container()
+
+	if !workload() {
+		if err := MountAll(defaultMounts()...); err != nil {
+			errs = append(errs, err)
+		}
+
+		if os.Getpid() == 1 && !container {
+			if err := Console(""); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if !container {
+		if err := LoadModules(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	cmdline, err := Cmdline()
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	if network, ok := cmdline["golinux.net"]; ok {
+		if err = Network(network); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if shares, ok := cmdline["golinux.shares"]; ok {
+		if err = MountShares(shares); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if port, ok := cmdline["golinux.agent"]; ok {
+		if err = serveAgent(ctx, port); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func Run(main func(context.Context) error) {
+	if os.Getpid() == 1 && !workload() {
+		supervise()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), unix.SIGTERM, unix.SIGINT)
+
+	if err := Setup(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "initrd:", err)
+	}
+
+	err := main(ctx)
+	cancel()
+
+	Poweroff(Code(err))
+}
+
+func supervise() {
+	if root := os.Getenv(containerRootEnv); root != "" && Container() {
+		if err := EnterContainer(root); err != nil {
+			fmt.Fprintln(os.Stderr, "initrd:", err)
+			Poweroff(1)
+		}
+	}
+
+	if err := MountAll(defaultMounts()...); err != nil {
+		fmt.Fprintln(os.Stderr, "initrd:", err)
+	}
+
+	if !Container() {
+		if err := Console(""); err != nil {
+			fmt.Fprintln(os.Stderr, "initrd:", err)
+		}
+	}
+
+	code, err := Supervise()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "initrd:", err)
+		code = 1
+	}
+
+	Poweroff(code)
+}
+
+func Code(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var code ExitCode
+	if errors.As(err, &code) {
+		return int(code)
+	}
+
+	var exitError interface{ ExitCode() int }
+	if errors.As(err, &exitError) && exitError.ExitCode() > 0 {
+		return exitError.ExitCode()
+	}
+
+	fmt.Fprintln(os.Stderr, "init:", err)
+	return 1
+}
+
+func serveAgent(ctx context.Context, port string) error {
+	p, err := strconv.ParseUint(port, 10, 32)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := agent.ListenAndServe(ctx, uint32(p)); err != nil && ctx.Err() == nil {
+			fmt.Fprintln(os.Stderr, "initrd: agent:", err)
+		}
+	}()
+
+	return nil
+}
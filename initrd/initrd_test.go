@@ -0,0 +1,307 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const helperEnv = "GOLINUX_INITRD_HELPER"
+
+var helpers = map[string]func() int{
+	"mount":     helperMount,
+	"container": helperContainer,
+	"poweroff":  helperPoweroff,
+	"reap":      helperReap,
+	"init":      helperInit,
+}
+
+func TestMain(m *testing.M) {
+	if helper, ok := helpers[os.Getenv(helperEnv)]; ok {
+		os.Exit(helper())
+	}
+
+	os.Exit(m.Run())
+}
+
+// helper runs the test binary again as the named helper, optionally inside
+// fresh user, mount and pid namespaces, and returns its exit code.
+func helper(t *testing.T, name string, namespaced bool, env ...string) int {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(append(os.Environ(), helperEnv+"="+name), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if namespaced {
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		}
+	}
+
+	err := cmd.Run()
+
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+
+	if err != nil {
+		if namespaced {
+			t.Skip("user namespaces are not available:", err)
+		}
+
+		t.Fatal(err)
+	}
+
+	return 0
+}
+
+func fail(format string, args ...any) int {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	return 99
+}
+
+func helperMount() int {
+	root := os.Getenv("GOLINUX_INITRD_ROOT")
+
+	err := MountAll(
+		&Mount{Source: "tmpfs", Target: filepath.Join(root, "tmp"), Type: "tmpfs", Flags: unix.MS_NOSUID | unix.MS_NODEV, Data: "mode=1777"},
+		&Mount{Source: "proc", Target: filepath.Join(root, "proc"), Type: "proc", Flags: unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC},
+	)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	for _, target := range []string{"tmp", "proc"} {
+		if !strings.Contains(string(data), " "+filepath.Join(root, target)+" ") {
+			return fail("%s is not mounted", target)
+		}
+	}
+
+	if _, err = os.Stat(filepath.Join(root, "proc", "1", "stat")); err != nil {
+		return fail("%v", err)
+	}
+
+	return 0
+}
+
+func helperContainer() int {
+	if err := EnterContainer(os.Getenv(containerRootEnv)); err != nil {
+		return fail("%v", err)
+	}
+
+	if _, err := os.Stat("/marker"); err != nil {
+		return fail("%v", err)
+	}
+
+	if err := os.WriteFile("/dev/null", []byte("discarded"), 0); err != nil {
+		return fail("%v", err)
+	}
+
+	data := make([]byte, 8)
+
+	file, err := os.Open("/dev/zero")
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	defer file.Close()
+
+	if _, err = file.Read(data); err != nil || string(data) != string(make([]byte, 8)) {
+		return fail("reading /dev/zero: %q %v", data, err)
+	}
+
+	if target, err := os.Readlink("/dev/ptmx"); err != nil || target != "pts/ptmx" {
+		return fail("/dev/ptmx links to %q: %v", target, err)
+	}
+
+	if os.Getenv(containerRootEnv) != "" {
+		return fail("%s is still set", containerRootEnv)
+	}
+
+	return 0
+}
+
+func helperPoweroff() int {
+	Poweroff(7)
+	return fail("poweroff returned")
+}
+
+func helperReap() int {
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return fail("%v", err)
+	}
+
+	cmd := exec.Command("sh", "-c", "sleep 0.05 & exit 3")
+	if err := cmd.Start(); err != nil {
+		return fail("%v", err)
+	}
+
+	code, err := Reap(cmd.Process.Pid)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	if code != 3 {
+		return fail("exit code %d, want 3", code)
+	}
+
+	return 0
+}
+
+// helperInit plays /init: PID 1 mounts /proc and supervises, the workload uses
+// os/exec while orphans are being reaped and exits with a known code.
+func helperInit() int {
+	if !workload() {
+		err := MountAll(&Mount{Source: "proc", Target: "/proc", Type: "proc", Flags: unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC})
+		if err != nil {
+			return fail("%v", err)
+		}
+
+		code, err := Supervise()
+		if err != nil {
+			return fail("%v", err)
+		}
+
+		return code
+	}
+
+	if os.Getpid() == 1 {
+		return fail("workload is PID 1")
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := exec.Command("sh", "-c", "sleep 0.01 & sleep 0.01 & exit 0").Run(); err != nil {
+			return fail("%v", err)
+		}
+
+		err := exec.Command("sh", "-c", "exit 4").Run()
+
+		var exitError *exec.ExitError
+		if !errors.As(err, &exitError) || exitError.ExitCode() != 4 {
+			return fail("exec returned %v, want exit status 4", err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	zombies, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	for _, name := range zombies {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+
+		fields := strings.Fields(string(data[strings.LastIndexByte(string(data), ')')+1:]))
+		if len(fields) > 1 && fields[0] == "Z" && fields[1] == "1" {
+			return fail("zombie left behind: %s", name)
+		}
+	}
+
+	Poweroff(6)
+	return fail("poweroff returned")
+}
+
+func TestMountAll(t *testing.T) {
+	root := t.TempDir()
+
+	if code := helper(t, "mount", true, "GOLINUX_INITRD_ROOT="+root); code != 0 {
+		t.Fatalf("mount helper exited with %d", code)
+	}
+}
+
+func TestEnterContainer(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(root, "marker"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := helper(t, "container", true, containerRootEnv+"="+root); code != 0 {
+		t.Fatalf("container helper exited with %d", code)
+	}
+}
+
+func TestCmdline(t *testing.T) {
+	t.Setenv("container", "golinux")
+	t.Setenv("GOLINUX_CMDLINE", "console=ttyS0 quiet golinux.net=10.0.2.15/24,10.0.2.2 golinux.agent=1024")
+
+	cmdline, err := Cmdline()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"console":       "ttyS0",
+		"quiet":         "",
+		"golinux.net":   "10.0.2.15/24,10.0.2.2",
+		"golinux.agent": "1024",
+	}
+
+	if len(cmdline) != len(expected) {
+		t.Fatalf("got %v, want %v", cmdline, expected)
+	}
+
+	for key, value := range expected {
+		if got, ok := cmdline[key]; !ok || got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestPoweroff(t *testing.T) {
+	if code := helper(t, "poweroff", false); code != 7 {
+		t.Fatalf("exit code %d, want 7", code)
+	}
+}
+
+func TestReap(t *testing.T) {
+	if code := helper(t, "reap", false); code != 0 {
+		t.Fatalf("reap helper exited with %d", code)
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	if code := helper(t, "init", true); code != 6 {
+		t.Fatalf("init exited with %d, want 6", code)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"errors"
+	"github.com/Dviih/golinux/kmod"
+	"golang.org/x/sys/unix"
+	"os"
+	"path"
+	"strings"
+)
+
+func Release() (string, error) {
+	var uname unix.Utsname
+
+	if err := unix.Uname(&uname); err != nil {
+		return "", err
+	}
+
+	return unix.ByteSliceToString(uname.Release[:]), nil
+}
+
+func LoadModule(name, parameters string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	flags := 0
+	if !strings.HasSuffix(name, ".ko") {
+		flags |= unix.MODULE_INIT_COMPRESSED_FILE
+	}
+
+	if err = unix.FinitModule(int(file.Fd()), parameters, flags); err != nil && !errors.Is(err, unix.EEXIST) {
+		return &os.PathError{Op: "finit_module", Path: name, Err: err}
+	}
+
+	return nil
+}
+
+func LoadModules() error {
+	release, err := Release()
+	if err != nil {
+		return err
+	}
+
+	root := path.Join("/lib", "modules", release)
+
+	dep, err := kmod.ReadFile(path.Join(root, "modules.dep"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	modules, err := dep.Resolve(dep.Modules()...)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, module := range modules {
+		if err = LoadModule(path.Join(root, module), ""); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
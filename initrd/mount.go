@@ -0,0 +1,82 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+type Mount struct {
+	Source string
+	Target string
+	Type   string
+	Flags  uintptr
+	Data   string
+}
+
+var Mounts = []*Mount{
+	{Source: "proc", Target: "/proc", Type: "proc", Flags: unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC},
+	{Source: "sysfs", Target: "/sys", Type: "sysfs", Flags: unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC},
+	{Source: "devtmpfs", Target: "/dev", Type: "devtmpfs", Flags: unix.MS_NOSUID, Data: "mode=0755"},
+	{Source: "devpts", Target: "/dev/pts", Type: "devpts", Flags: unix.MS_NOSUID | unix.MS_NOEXEC, Data: "gid=5,mode=0620,ptmxmode=0666"},
+	{Source: "tmpfs", Target: "/dev/shm", Type: "tmpfs", Flags: unix.MS_NOSUID | unix.MS_NODEV, Data: "mode=1777"},
+	{Source: "cgroup2", Target: "/sys/fs/cgroup", Type: "cgroup2", Flags: unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC},
+	{Source: "tmpfs", Target: "/tmp", Type: "tmpfs", Flags: unix.MS_NOSUID | unix.MS_NODEV, Data: "mode=1777"},
+	{Source: "tmpfs", Target: "/run", Type: "tmpfs", Flags: unix.MS_NOSUID | unix.MS_NODEV, Data: "mode=0755"},
+}
+
+func (mount *Mount) Mount() error {
+	if err := os.MkdirAll(mount.Target, 0755); err != nil {
+		return err
+	}
+
+	err := unix.Mount(mount.Source, mount.Target, mount.Type, mount.Flags, mount.Data)
+	if err != nil && !errors.Is(err, unix.EBUSY) {
+		return &os.PathError{Op: "mount " + mount.Type, Path: mount.Target, Err: err}
+	}
+
+	return nil
+}
+
+func defaultMounts() []*Mount {
+	if Container() {
+		return ContainerMounts
+	}
+
+	return Mounts
+}
+
+func MountAll(mounts ...*Mount) error {
+	if len(mounts) == 0 {
+		mounts = Mounts
+	}
+
+	var errs []error
+
+	for _, mount := range mounts {
+		if err := mount.Mount(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,214 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"encoding/binary"
+	"errors"
+	"golang.org/x/sys/unix"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"syscall"
+)
+
+const DefaultInterface = "eth0"
+
+func ioctlSocket() (int, error) {
+	return unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+}
+
+func LinkUp(name string) error {
+	fd, err := ioctlSocket()
+	if err != nil {
+		return err
+	}
+
+	defer unix.Close(fd)
+
+	ifreq, err := unix.NewIfreq(name)
+	if err != nil {
+		return err
+	}
+
+	if err = unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifreq); err != nil {
+		return err
+	}
+
+	ifreq.SetUint16(ifreq.Uint16() | unix.IFF_UP | unix.IFF_RUNNING)
+
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifreq)
+}
+
+func SetAddress(name string, prefix netip.Prefix) error {
+	if !prefix.Addr().Is4() {
+		return errors.New("only IPv4 addresses are supported")
+	}
+
+	fd, err := ioctlSocket()
+	if err != nil {
+		return err
+	}
+
+	defer unix.Close(fd)
+
+	ifreq, err := unix.NewIfreq(name)
+	if err != nil {
+		return err
+	}
+
+	address := prefix.Addr().As4()
+
+	if err = ifreq.SetInet4Addr(address[:]); err != nil {
+		return err
+	}
+
+	if err = unix.IoctlIfreq(fd, unix.SIOCSIFADDR, ifreq); err != nil {
+		return err
+	}
+
+	if ifreq, err = unix.NewIfreq(name); err != nil {
+		return err
+	}
+
+	if err = ifreq.SetInet4Addr(net.CIDRMask(prefix.Bits(), 32)); err != nil {
+		return err
+	}
+
+	return unix.IoctlIfreq(fd, unix.SIOCSIFNETMASK, ifreq)
+}
+
+func AddDefaultRoute(gateway netip.Addr) error {
+	if !gateway.Is4() {
+		return errors.New("only IPv4 gateways are supported")
+	}
+
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+
+	defer unix.Close(fd)
+
+	if err = unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	length := unix.SizeofNlMsghdr + unix.SizeofRtMsg + unix.SizeofRtAttr + 4
+	message := make([]byte, length)
+
+	binary.NativeEndian.PutUint32(message[0:], uint32(length))
+	binary.NativeEndian.PutUint16(message[4:], unix.RTM_NEWROUTE)
+	binary.NativeEndian.PutUint16(message[6:], unix.NLM_F_REQUEST|unix.NLM_F_ACK|unix.NLM_F_CREATE|unix.NLM_F_EXCL)
+	binary.NativeEndian.PutUint32(message[8:], 1)
+
+	rtmsg := message[unix.SizeofNlMsghdr:]
+	rtmsg[0] = unix.AF_INET
+	rtmsg[4] = unix.RT_TABLE_MAIN
+	rtmsg[5] = unix.RTPROT_BOOT
+	rtmsg[6] = unix.RT_SCOPE_UNIVERSE
+	rtmsg[7] = unix.RTN_UNICAST
+
+	attribute := rtmsg[unix.SizeofRtMsg:]
+	binary.NativeEndian.PutUint16(attribute[0:], unix.SizeofRtAttr+4)
+	binary.NativeEndian.PutUint16(attribute[2:], unix.RTA_GATEWAY)
+
+	address := gateway.As4()
+	copy(attribute[unix.SizeofRtAttr:], address[:])
+
+	if err = unix.Sendto(fd, message, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	response := make([]byte, unix.Getpagesize())
+
+	n, _, err := unix.Recvfrom(fd, response, 0)
+	if err != nil {
+		return err
+	}
+
+	messages, err := syscall.ParseNetlinkMessage(response[:n])
+	if err != nil {
+		return err
+	}
+
+	for _, m := range messages {
+		if m.Header.Type != unix.NLMSG_ERROR || len(m.Data) < 4 {
+			continue
+		}
+
+		if code := int32(binary.NativeEndian.Uint32(m.Data)); code != 0 {
+			return unix.Errno(-code)
+		}
+	}
+
+	return nil
+}
+
+func Network(spec string) error {
+	if err := LinkUp("lo"); err != nil {
+		return err
+	}
+
+	if spec == "lo" {
+		return nil
+	}
+
+	if err := LinkUp(DefaultInterface); err != nil {
+		return err
+	}
+
+	if spec == "" || spec == "up" {
+		return nil
+	}
+
+	fields := strings.Split(spec, ",")
+
+	prefix, err := netip.ParsePrefix(fields[0])
+	if err != nil {
+		return err
+	}
+
+	if err = SetAddress(DefaultInterface, prefix); err != nil {
+		return err
+	}
+
+	if len(fields) > 1 && fields[1] != "" {
+		gateway, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return err
+		}
+
+		if err = AddDefaultRoute(gateway); err != nil && !errors.Is(err, unix.EEXIST) {
+			return err
+		}
+	}
+
+	if len(fields) > 2 && fields[2] != "" {
+		if err = os.MkdirAll("/etc", 0755); err != nil {
+			return err
+		}
+
+		return os.WriteFile("/etc/resolv.conf", []byte("nameserver "+fields[2]+"\n"), 0644)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+const keyPower = 116
+
+func Poweroff(code int) {
+	unix.Sync()
+
+	if os.Getpid() != 1 || Container() {
+		os.Exit(code)
+	}
+
+	cmdline, _ := Cmdline()
+
+	// microVMs have no exit device, the host reads the status from the console.
+	if _, ok := cmdline["golinux.status"]; ok {
+		fmt.Printf("golinux: exit status %d\n", code)
+	} else if code != 0 {
+		_ = exit(code)
+	}
+
+	// firecracker only stops on the i8042 reset that reboot=k makes a restart use.
+	command := unix.LINUX_REBOOT_CMD_POWER_OFF
+	if _, ok := cmdline["golinux.reboot"]; ok {
+		command = unix.LINUX_REBOOT_CMD_RESTART
+	}
+
+	if err := unix.Reboot(command); err != nil {
+		os.Exit(code)
+	}
+
+	select {}
+}
+
+func Reboot() error {
+	unix.Sync()
+	return unix.Reboot(unix.LINUX_REBOOT_CMD_RESTART)
+}
+
+// PowerButton calls fn whenever an input device reports the power key, which
+// is how an ACPI or GPIO power button such as QEMU's system_powerdown arrives.
+func PowerButton(fn func()) error {
+	devices, err := filepath.Glob("/dev/input/event*")
+	if err != nil {
+		return err
+	}
+
+	for _, device := range devices {
+		file, err := os.Open(device)
+		if err != nil {
+			continue
+		}
+
+		go watchPowerButton(file, fn)
+	}
+
+	return nil
+}
+
+func watchPowerButton(file *os.File, fn func()) {
+	defer file.Close()
+
+	// struct input_event is a timeval followed by type, code and value.
+	size := int(unsafe.Sizeof(unix.Timeval{})) + 8
+	event := make([]byte, size)
+
+	for {
+		if _, err := io.ReadFull(file, event); err != nil {
+			return
+		}
+
+		kind := binary.NativeEndian.Uint16(event[size-8:])
+		code := binary.NativeEndian.Uint16(event[size-6:])
+		value := int32(binary.NativeEndian.Uint32(event[size-4:]))
+
+		if kind == unix.EV_KEY && code == keyPower && value == 1 {
+			fn()
+		}
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+	"os/signal"
+	"time"
+)
+
+const (
+	workloadEnv = "GOLINUX_WORKLOAD"
+
+	// shutdownTimeout is how long the workload has to exit after SIGTERM.
+	shutdownTimeout = 10 * time.Second
+)
+
+func workload() bool {
+	return os.Getenv(workloadEnv) != ""
+}
+
+// Reap waits for pid while collecting every other child that exits, including
+// orphans re-parented to this process, and returns the exit code of pid.
+func Reap(pid int) (int, error) {
+	for {
+		var status unix.WaitStatus
+
+		wpid, err := unix.Wait4(-1, &status, 0, nil)
+		if err == unix.EINTR {
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if wpid != pid || status.Stopped() || status.Continued() {
+			continue
+		}
+
+		if status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+
+		return status.ExitStatus(), nil
+	}
+}
+
+// Supervise starts the current executable again as the workload and reaps
+// until it exits. PID 1 never runs os/exec itself, so wait calls made by the
+// workload cannot race with the reaper. SIGTERM, SIGINT and the power button
+// are passed on to the workload.
+func Supervise() (int, error) {
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return 0, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, unix.SIGTERM, unix.SIGINT)
+
+	defer signal.Stop(signals)
+
+	process, err := os.StartProcess("/proc/self/exe", os.Args, &os.ProcAttr{
+		Env:   append(os.Environ(), workloadEnv+"=1"),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	defer process.Release()
+
+	_ = PowerButton(func() {
+		select {
+		case signals <- unix.SIGTERM:
+		default:
+		}
+	})
+
+	go func() {
+		for sig := range signals {
+			_ = process.Signal(sig)
+
+			if sig == unix.SIGTERM {
+				time.AfterFunc(shutdownTimeout, func() {
+					_ = process.Kill()
+				})
+			}
+		}
+	}()
+
+	return Reap(process.Pid)
+}
@@ -0,0 +1,66 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package initrd
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"net/url"
+	"strings"
+)
+
+func MountShares(shares string) error {
+	var errs []error
+
+	for _, share := range strings.Split(shares, ",") {
+		fields := strings.Split(share, ":")
+		if len(fields) < 3 {
+			errs = append(errs, errors.New("invalid share: "+share))
+			continue
+		}
+
+		target, err := url.PathUnescape(fields[1])
+		if err != nil {
+			errs = append(errs, errors.New("invalid share target: "+fields[1]))
+			continue
+		}
+
+		mount := &Mount{Source: fields[0], Target: target, Type: fields[2]}
+
+		switch mount.Type {
+		case "9p":
+			mount.Data = "trans=virtio,version=9p2000.L,msize=512000"
+		case "virtiofs":
+		default:
+			errs = append(errs, errors.New("invalid share type: "+mount.Type))
+			continue
+		}
+
+		if len(fields) > 3 && fields[3] == "ro" {
+			mount.Flags |= unix.MS_RDONLY
+		}
+
+		if err := mount.Mount(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
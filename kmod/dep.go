@@ -0,0 +1,222 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package kmod
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var moduleExtensions = []string{".ko.zst", ".ko.xz", ".ko.gz", ".ko"}
+
+type Dep struct {
+	order []string
+	deps  map[string][]string
+}
+
+func Name(s string) string {
+	s = path.Base(s)
+
+	for _, extension := range moduleExtensions {
+		if strings.HasSuffix(s, extension) {
+			s = s[:len(s)-len(extension)]
+			break
+		}
+	}
+
+	return strings.ReplaceAll(s, "-", "_")
+}
+
+func Read(reader io.Reader) (*Dep, error) {
+	dep := &Dep{deps: make(map[string][]string)}
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		module, deps, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid modules.dep line: %s", line)
+		}
+
+		dep.order = append(dep.order, module)
+		dep.deps[module] = strings.Fields(deps)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return dep, nil
+}
+
+func ReadFile(name string) (*Dep, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return Read(file)
+}
+
+func (dep *Dep) Modules() []string {
+	return dep.order
+}
+
+func (dep *Dep) Dependencies(module string) []string {
+	return dep.deps[module]
+}
+
+func (dep *Dep) Find(name string) (string, bool) {
+	if _, ok := dep.deps[name]; ok {
+		return name, true
+	}
+
+	name = Name(name)
+
+	for _, module := range dep.order {
+		if Name(module) == name {
+			return module, true
+		}
+	}
+
+	return "", false
+}
+
+func (dep *Dep) Resolve(names ...string) ([]string, error) {
+	var (
+		resolved []string
+		visit    func(string, []string) error
+	)
+
+	seen := make(map[string]bool)
+
+	visit = func(module string, stack []string) error {
+		for _, parent := range stack {
+			if parent == module {
+				return fmt.Errorf("circular module dependency: %s", strings.Join(append(stack, module), " -> "))
+			}
+		}
+
+		if seen[module] {
+			return nil
+		}
+
+		deps, ok := dep.deps[module]
+		if !ok {
+			return fmt.Errorf("module %s is not in modules.dep", module)
+		}
+
+		for _, d := range deps {
+			if err := visit(d, append(stack, module)); err != nil {
+				return err
+			}
+		}
+
+		seen[module] = true
+		resolved = append(resolved, module)
+
+		return nil
+	}
+
+	for _, name := range names {
+		module, ok := dep.Find(name)
+		if !ok {
+			return nil, errors.New("module not found: " + name)
+		}
+
+		if err := visit(module, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
+
+func (dep *Dep) Filter(modules []string) *Dep {
+	filtered := &Dep{deps: make(map[string][]string)}
+	keep := make(map[string]bool)
+
+	for _, module := range modules {
+		keep[module] = true
+	}
+
+	for _, module := range dep.order {
+		if !keep[module] {
+			continue
+		}
+
+		filtered.order = append(filtered.order, module)
+		filtered.deps[module] = dep.deps[module]
+	}
+
+	return filtered
+}
+
+func (dep *Dep) Add(module string, deps ...string) {
+	if dep.deps == nil {
+		dep.deps = make(map[string][]string)
+	}
+
+	if _, ok := dep.deps[module]; !ok {
+		dep.order = append(dep.order, module)
+	}
+
+	dep.deps[module] = deps
+}
+
+func (dep *Dep) Merge(other *Dep) *Dep {
+	merged := &Dep{deps: make(map[string][]string)}
+
+	for _, module := range dep.order {
+		merged.Add(module, dep.deps[module]...)
+	}
+
+	for _, module := range other.order {
+		merged.Add(module, other.deps[module]...)
+	}
+
+	return merged
+}
+
+func (dep *Dep) WriteTo(writer io.Writer) (int64, error) {
+	var written int64
+
+	for _, module := range dep.order {
+		n, err := fmt.Fprintf(writer, "%s: %s\n", module, strings.Join(dep.deps[module], " "))
+		written += int64(n)
+
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
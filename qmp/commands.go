@@ -0,0 +1,97 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package qmp
+
+import (
+	"context"
+)
+
+type Status struct {
+	Running    bool   `json:"running"`
+	Singlestep bool   `json:"singlestep"`
+	Status     string `json:"status"`
+}
+
+func (client *Client) Status(ctx context.Context) (*Status, error) {
+	status := &Status{}
+
+	if err := client.Execute(ctx, "query-status", nil, status); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+func (client *Client) Stop(ctx context.Context) error {
+	return client.Execute(ctx, "stop", nil, nil)
+}
+
+func (client *Client) Cont(ctx context.Context) error {
+	return client.Execute(ctx, "cont", nil, nil)
+}
+
+func (client *Client) SystemPowerdown(ctx context.Context) error {
+	return client.Execute(ctx, "system_powerdown", nil, nil)
+}
+
+func (client *Client) SystemReset(ctx context.Context) error {
+	return client.Execute(ctx, "system_reset", nil, nil)
+}
+
+func (client *Client) Quit(ctx context.Context) error {
+	err := client.Execute(ctx, "quit", nil, nil)
+	if err == ErrClosed {
+		return nil
+	}
+
+	return err
+}
+
+func (client *Client) HumanMonitorCommand(ctx context.Context, command string) (string, error) {
+	var output string
+
+	if err := client.Execute(ctx, "human-monitor-command", map[string]string{"command-line": command}, &output); err != nil {
+		return "", err
+	}
+
+	return output, nil
+}
+
+func (client *Client) SaveVM(ctx context.Context, name string) (string, error) {
+	return client.HumanMonitorCommand(ctx, "savevm "+name)
+}
+
+func (client *Client) LoadVM(ctx context.Context, name string) (string, error) {
+	return client.HumanMonitorCommand(ctx, "loadvm "+name)
+}
+
+func (client *Client) DeviceAdd(ctx context.Context, driver, id string, properties map[string]interface{}) error {
+	arguments := map[string]interface{}{"driver": driver, "id": id}
+
+	for key, value := range properties {
+		arguments[key] = value
+	}
+
+	return client.Execute(ctx, "device_add", arguments, nil)
+}
+
+func (client *Client) DeviceDel(ctx context.Context, id string) error {
+	return client.Execute(ctx, "device_del", map[string]string{"id": id}, nil)
+}
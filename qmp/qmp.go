@@ -0,0 +1,257 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package qmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrClosed = errors.New("qmp: connection closed")
+
+type Error struct {
+	Class       string `json:"class"`
+	Description string `json:"desc"`
+}
+
+func (err *Error) Error() string {
+	return "qmp: " + err.Class + ": " + err.Description
+}
+
+type Timestamp struct {
+	Seconds      int64 `json:"seconds"`
+	Microseconds int64 `json:"microseconds"`
+}
+
+func (timestamp Timestamp) Time() time.Time {
+	return time.Unix(timestamp.Seconds, timestamp.Microseconds*1000)
+}
+
+type Event struct {
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp Timestamp       `json:"timestamp"`
+}
+
+type Greeting struct {
+	QMP struct {
+		Version struct {
+			QEMU struct {
+				Major int `json:"major"`
+				Minor int `json:"minor"`
+				Micro int `json:"micro"`
+			} `json:"qemu"`
+			Package string `json:"package"`
+		} `json:"version"`
+		Capabilities []string `json:"capabilities"`
+	} `json:"QMP"`
+}
+
+type command struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+	ID        string      `json:"id"`
+}
+
+type message struct {
+	Return json.RawMessage `json:"return"`
+	Error  *Error          `json:"error"`
+	ID     string          `json:"id"`
+
+	Event
+}
+
+type Client struct {
+	m       sync.Mutex
+	conn    net.Conn
+	id      uint64
+	pending map[string]chan *message
+	events  chan *Event
+	done    chan struct{}
+	err     error
+
+	Greeting *Greeting
+}
+
+func Dial(ctx context.Context, socket string) (*Client, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(ctx, conn)
+}
+
+func NewClient(ctx context.Context, conn net.Conn) (*Client, error) {
+	client := &Client{
+		conn:     conn,
+		pending:  make(map[string]chan *message),
+		events:   make(chan *Event, 64),
+		done:     make(chan struct{}),
+		Greeting: &Greeting{},
+	}
+
+	reader := bufio.NewReader(conn)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	_ = conn.SetReadDeadline(time.Time{})
+
+	if err = json.Unmarshal(line, client.Greeting); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go client.read(reader)
+
+	if err = client.Execute(ctx, "qmp_capabilities", nil, nil); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (client *Client) read(reader *bufio.Reader) {
+	defer close(client.events)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			client.fail(err)
+			return
+		}
+
+		msg := &message{}
+
+		if err = json.Unmarshal(line, msg); err != nil {
+			continue
+		}
+
+		if msg.Event.Event != "" {
+			event := msg.Event
+
+			select {
+			case client.events <- &event:
+			default:
+			}
+
+			continue
+		}
+
+		client.m.Lock()
+		pending, ok := client.pending[msg.ID]
+		delete(client.pending, msg.ID)
+		client.m.Unlock()
+
+		if ok {
+			pending <- msg
+		}
+	}
+}
+
+func (client *Client) fail(err error) {
+	defer client.m.Unlock()
+	client.m.Lock()
+
+	if client.err != nil {
+		return
+	}
+
+	client.err = err
+	close(client.done)
+}
+
+func (client *Client) Events() <-chan *Event {
+	return client.events
+}
+
+func (client *Client) Done() <-chan struct{} {
+	return client.done
+}
+
+func (client *Client) Execute(ctx context.Context, name string, arguments interface{}, result interface{}) error {
+	client.m.Lock()
+
+	if client.err != nil {
+		client.m.Unlock()
+		return ErrClosed
+	}
+
+	client.id++
+	id := strconv.FormatUint(client.id, 10)
+
+	pending := make(chan *message, 1)
+	client.pending[id] = pending
+
+	data, err := json.Marshal(&command{Execute: name, Arguments: arguments, ID: id})
+	if err == nil {
+		_, err = client.conn.Write(append(data, '\n'))
+	}
+
+	if err != nil {
+		delete(client.pending, id)
+		client.m.Unlock()
+
+		return err
+	}
+
+	client.m.Unlock()
+
+	select {
+	case <-ctx.Done():
+		client.m.Lock()
+		delete(client.pending, id)
+		client.m.Unlock()
+
+		return ctx.Err()
+	case <-client.done:
+		return ErrClosed
+	case msg := <-pending:
+		if msg.Error != nil {
+			return msg.Error
+		}
+
+		if result == nil || len(msg.Return) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(msg.Return, result)
+	}
+}
+
+func (client *Client) Close() error {
+	client.fail(ErrClosed)
+	return client.conn.Close()
+}
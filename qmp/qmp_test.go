@@ -0,0 +1,256 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package qmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const greeting = `{"QMP": {"version": {"qemu": {"micro": 2, "minor": 2, "major": 9}, "package": "v9.2.2"}, "capabilities": ["oob"]}}`
+
+type fakeServer struct {
+	t        *testing.T
+	listener net.Listener
+	socket   string
+
+	m        sync.Mutex
+	commands []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "qmp.sock")
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeServer{t: t, listener: listener, socket: socket}
+	t.Cleanup(func() { listener.Close() })
+
+	go server.serve()
+	return server
+}
+
+func (server *fakeServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go server.handle(conn)
+	}
+}
+
+func (server *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+	send := func(v interface{}) {
+		_ = encoder.Encode(v)
+	}
+
+	if _, err := conn.Write([]byte(greeting + "\r\n")); err != nil {
+		return
+	}
+
+	negotiated := false
+	scanner := bufio.NewScanner(conn)
+
+	for scanner.Scan() {
+		request := &command{}
+
+		if err := json.Unmarshal(scanner.Bytes(), request); err != nil {
+			send(map[string]interface{}{"error": map[string]string{"class": "GenericError", "desc": "JSON parse error"}})
+			continue
+		}
+
+		server.m.Lock()
+		server.commands = append(server.commands, request.Execute)
+		server.m.Unlock()
+
+		if !negotiated && request.Execute != "qmp_capabilities" {
+			send(map[string]interface{}{"id": request.ID, "error": map[string]string{"class": "CommandNotFound", "desc": "Expecting capabilities negotiation with 'qmp_capabilities'"}})
+			continue
+		}
+
+		switch request.Execute {
+		case "qmp_capabilities":
+			negotiated = true
+			send(map[string]interface{}{"id": request.ID, "return": map[string]string{}})
+		case "query-status":
+			send(map[string]interface{}{"id": request.ID, "return": map[string]interface{}{"running": true, "singlestep": false, "status": "running"}})
+		case "stop":
+			send(map[string]interface{}{"event": "STOP", "data": map[string]string{}, "timestamp": map[string]int64{"seconds": 1700000000, "microseconds": 250}})
+			send(map[string]interface{}{"id": request.ID, "return": map[string]string{}})
+		case "human-monitor-command":
+			send(map[string]interface{}{"id": request.ID, "return": "ok\r\n"})
+		case "quit":
+			send(map[string]interface{}{"id": request.ID, "return": map[string]string{}})
+			send(map[string]interface{}{"event": "SHUTDOWN", "data": map[string]interface{}{"guest": false, "reason": "host-qmp-quit"}, "timestamp": map[string]int64{"seconds": 1700000001}})
+			return
+		default:
+			send(map[string]interface{}{"id": request.ID, "error": map[string]string{"class": "CommandNotFound", "desc": "The command " + request.Execute + " has not been found"}})
+		}
+	}
+}
+
+func (server *fakeServer) Commands() []string {
+	defer server.m.Unlock()
+	server.m.Lock()
+
+	return append([]string{}, server.commands...)
+}
+
+func dial(t *testing.T, server *fakeServer) *Client {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, server.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestGreeting(t *testing.T) {
+	server := newFakeServer(t)
+	client := dial(t, server)
+
+	version := client.Greeting.QMP.Version
+	if version.QEMU.Major != 9 || version.QEMU.Minor != 2 || version.QEMU.Micro != 2 || version.Package != "v9.2.2" {
+		t.Errorf("unexpected version %+v", version)
+	}
+
+	if capabilities := client.Greeting.QMP.Capabilities; len(capabilities) != 1 || capabilities[0] != "oob" {
+		t.Errorf("unexpected capabilities %v", capabilities)
+	}
+
+	if commands := server.Commands(); len(commands) != 1 || commands[0] != "qmp_capabilities" {
+		t.Errorf("capabilities were not negotiated first: %v", commands)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	client := dial(t, newFakeServer(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Running || status.Status != "running" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	output, err := client.HumanMonitorCommand(ctx, "info version")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output != "ok\r\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	client := dial(t, newFakeServer(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-client.Events():
+		if event.Event != "STOP" {
+			t.Errorf("unexpected event %s", event.Event)
+		}
+
+		if want := time.Unix(1700000000, 250000); !event.Timestamp.Time().Equal(want) {
+			t.Errorf("timestamp %v, want %v", event.Timestamp.Time(), want)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event received")
+	}
+}
+
+func TestError(t *testing.T) {
+	client := dial(t, newFakeServer(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := client.Execute(ctx, "no-such-command", nil, nil)
+
+	var qmpError *Error
+	if !errors.As(err, &qmpError) {
+		t.Fatalf("got %v, want *Error", err)
+	}
+
+	if qmpError.Class != "CommandNotFound" {
+		t.Errorf("class %s, want CommandNotFound", qmpError.Class)
+	}
+
+	if _, err = client.Status(ctx); err != nil {
+		t.Errorf("client unusable after an error response: %v", err)
+	}
+}
+
+func TestQuit(t *testing.T) {
+	client := dial(t, newFakeServer(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Quit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-client.Done():
+	case <-ctx.Done():
+		t.Fatal("client not done after the server closed")
+	}
+
+	if err := client.Execute(ctx, "query-status", nil, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+}
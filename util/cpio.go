@@ -0,0 +1,203 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package util
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const cpioTrailer = "TRAILER!!!"
+
+type CPIO struct {
+	writer  io.Writer
+	written int64
+	ino     uint32
+}
+
+func NewCPIO(writer io.Writer) *CPIO {
+	return &CPIO{writer: writer, ino: 1}
+}
+
+func (cpio *CPIO) header(name string, mode uint32, size int64, rdev uint64) error {
+	cpio.ino++
+
+	_, err := fmt.Fprintf(cpio.writer, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+		cpio.ino, mode, 0, 0, 1, 0, size, 0, 0, (rdev>>8)&0xfff, (rdev&0xff)|((rdev>>12)&0xfff00), len(name)+1, 0)
+	if err != nil {
+		return err
+	}
+
+	cpio.written += 110
+
+	if err = cpio.write([]byte(name + "\x00")); err != nil {
+		return err
+	}
+
+	return cpio.pad()
+}
+
+func (cpio *CPIO) write(data []byte) error {
+	n, err := cpio.writer.Write(data)
+	cpio.written += int64(n)
+
+	return err
+}
+
+func (cpio *CPIO) pad() error {
+	if n := cpio.written % 4; n != 0 {
+		return cpio.write(make([]byte, 4-n))
+	}
+
+	return nil
+}
+
+func (cpio *CPIO) Directory(name string, perm fs.FileMode) error {
+	return cpio.header(name, syscall.S_IFDIR|uint32(perm.Perm()), 0, 0)
+}
+
+func (cpio *CPIO) File(name string, perm fs.FileMode, reader io.Reader, size int64) error {
+	if err := cpio.header(name, syscall.S_IFREG|uint32(perm.Perm()), size, 0); err != nil {
+		return err
+	}
+
+	n, err := io.CopyN(cpio.writer, reader, size)
+	cpio.written += n
+
+	if err != nil {
+		return err
+	}
+
+	return cpio.pad()
+}
+
+func (cpio *CPIO) Symlink(name, target string) error {
+	if err := cpio.header(name, syscall.S_IFLNK|0777, int64(len(target)), 0); err != nil {
+		return err
+	}
+
+	if err := cpio.write([]byte(target)); err != nil {
+		return err
+	}
+
+	return cpio.pad()
+}
+
+func (cpio *CPIO) Device(name string, mode uint32, rdev uint64) error {
+	return cpio.header(name, mode, 0, rdev)
+}
+
+func (cpio *CPIO) AddDirectory(root, prefix string) error {
+	return filepath.WalkDir(root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+
+		if relative == "." {
+			if prefix == "" {
+				return nil
+			}
+
+			relative = ""
+		}
+
+		relative = strings.TrimPrefix(filepath.ToSlash(filepath.Join(prefix, relative)), "/")
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			return cpio.Directory(relative, mode)
+		case mode&fs.ModeSymlink != 0:
+			target, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+
+			return cpio.Symlink(relative, target)
+		case mode&fs.ModeDevice != 0:
+			stat, ok := info.Sys().(*syscall.Stat_t)
+			if !ok {
+				return nil
+			}
+
+			return cpio.Device(relative, stat.Mode, stat.Rdev)
+		case mode.IsRegular():
+			file, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+
+			defer file.Close()
+
+			return cpio.File(relative, mode, file, info.Size())
+		default:
+			return nil
+		}
+	})
+}
+
+func (cpio *CPIO) Close() error {
+	if err := cpio.header(cpioTrailer, 0, 0, 0); err != nil {
+		return err
+	}
+
+	if n := cpio.written % 512; n != 0 {
+		return cpio.write(make([]byte, 512-n))
+	}
+
+	return nil
+}
+
+func WriteCPIO(name string, roots ...string) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	cpio := NewCPIO(file)
+
+	for _, root := range roots {
+		if err = cpio.AddDirectory(root, ""); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err = cpio.Close(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,184 @@
+/*
+ *     Execute binaries on bare Linux.
+ *     Copyright (C) 2025  Dviih
+ *
+ *     This program is free software: you can redistribute it and/or modify
+ *     it under the terms of the GNU Affero General Public License as published
+ *     by the Free Software Foundation, either version 3 of the License, or
+ *     (at your option) any later version.
+ *
+ *     This program is distributed in the hope that it will be useful,
+ *     but WITHOUT ANY WARRANTY; without even the implied warranty of
+ *     MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ *     GNU Affero General Public License for more details.
+ *
+ *     You should have received a copy of the GNU Affero General Public License
+ *     along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ *
+ */
+
+package util
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	SectorSize = 512
+
+	gptEntries    = 128
+	gptEntrySize  = 128
+	gptHeaderSize = 92
+	gptTableSize  = gptEntries * gptEntrySize / SectorSize
+)
+
+const (
+	GPTTypeESP  = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+	GPTFirstLBA = 2048
+)
+
+type GUID [16]byte
+
+func ParseGUID(s string) (GUID, error) {
+	var guid GUID
+
+	data, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		return guid, err
+	}
+
+	if len(data) != 16 {
+		return guid, errors.New("invalid guid: " + s)
+	}
+
+	binary.LittleEndian.PutUint32(guid[0:], binary.BigEndian.Uint32(data[0:]))
+	binary.LittleEndian.PutUint16(guid[4:], binary.BigEndian.Uint16(data[4:]))
+	binary.LittleEndian.PutUint16(guid[6:], binary.BigEndian.Uint16(data[6:]))
+	copy(guid[8:], data[8:])
+
+	return guid, nil
+}
+
+func NewGUID() (GUID, error) {
+	var guid GUID
+
+	if _, err := rand.Read(guid[:]); err != nil {
+		return guid, err
+	}
+
+	guid[7] = guid[7]&0x0f | 0x40
+	guid[8] = guid[8]&0x3f | 0x80
+
+	return guid, nil
+}
+
+type GPTPartition struct {
+	Type  GUID
+	GUID  GUID
+	First uint64
+	Last  uint64
+	Name  string
+}
+
+func gptEntryArray(partitions []*GPTPartition) []byte {
+	entries := make([]byte, gptEntries*gptEntrySize)
+
+	for i, partition := range partitions {
+		entry := entries[i*gptEntrySize:]
+
+		copy(entry[0:], partition.Type[:])
+		copy(entry[16:], partition.GUID[:])
+		binary.LittleEndian.PutUint64(entry[32:], partition.First)
+		binary.LittleEndian.PutUint64(entry[40:], partition.Last)
+
+		for j, c := range utf16.Encode([]rune(partition.Name)) {
+			if j >= 36 {
+				break
+			}
+
+			binary.LittleEndian.PutUint16(entry[56+j*2:], c)
+		}
+	}
+
+	return entries
+}
+
+func gptHeader(disk GUID, current, alternate, entries, sectors uint64, crc uint32) []byte {
+	header := make([]byte, SectorSize)
+
+	copy(header[0:], "EFI PART")
+	binary.LittleEndian.PutUint32(header[8:], 0x00010000)
+	binary.LittleEndian.PutUint32(header[12:], gptHeaderSize)
+	binary.LittleEndian.PutUint64(header[24:], current)
+	binary.LittleEndian.PutUint64(header[32:], alternate)
+	binary.LittleEndian.PutUint64(header[40:], 2+gptTableSize)
+	binary.LittleEndian.PutUint64(header[48:], sectors-2-gptTableSize)
+	copy(header[56:], disk[:])
+	binary.LittleEndian.PutUint64(header[72:], entries)
+	binary.LittleEndian.PutUint32(header[80:], gptEntries)
+	binary.LittleEndian.PutUint32(header[84:], gptEntrySize)
+	binary.LittleEndian.PutUint32(header[88:], crc)
+	binary.LittleEndian.PutUint32(header[16:], crc32.ChecksumIEEE(header[:gptHeaderSize]))
+
+	return header
+}
+
+func WriteGPT(writer io.WriterAt, size int64, partitions []*GPTPartition) error {
+	if len(partitions) > gptEntries {
+		return errors.New("too many partitions")
+	}
+
+	sectors := uint64(size / SectorSize)
+	if sectors < 2*(2+gptTableSize) {
+		return errors.New("disk too small for gpt")
+	}
+
+	for _, partition := range partitions {
+		if partition.First < 2+gptTableSize || partition.Last > sectors-2-gptTableSize || partition.First > partition.Last {
+			return errors.New("partition " + partition.Name + " is out of bounds")
+		}
+	}
+
+	disk, err := NewGUID()
+	if err != nil {
+		return err
+	}
+
+	mbr := make([]byte, SectorSize)
+	copy(mbr[446:], []byte{0x00, 0x00, 0x02, 0x00, 0xee, 0xff, 0xff, 0xff})
+	binary.LittleEndian.PutUint32(mbr[454:], 1)
+	binary.LittleEndian.PutUint32(mbr[458:], uint32(min(sectors-1, 0xffffffff)))
+	mbr[510], mbr[511] = 0x55, 0xaa
+
+	entries := gptEntryArray(partitions)
+	crc := crc32.ChecksumIEEE(entries)
+
+	last := sectors - 1
+	backup := last - gptTableSize
+
+	writes := []struct {
+		data []byte
+		lba  uint64
+	}{
+		{mbr, 0},
+		{gptHeader(disk, 1, last, 2, sectors, crc), 1},
+		{entries, 2},
+		{entries, backup},
+		{gptHeader(disk, last, 1, backup, sectors, crc), last},
+	}
+
+	for _, write := range writes {
+		if _, err = writer.WriteAt(write.data, int64(write.lba)*SectorSize); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -45,6 +45,7 @@ func GetKernel(project, target, version string) error {
 	}
 
 	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(KernelMirror, version[:strings.IndexByte(version, '.')], version), nil)
 	if err != nil {
@@ -70,6 +70,18 @@ func WDKernel(project, kernel string, paths ...interface{}) string {
 	return WDProject(project, wdAppend("kernel", kernel, paths)...)
 }
 
+func WDModules(project, kernel string, paths ...interface{}) string {
+	return WDProject(project, wdAppend("modules", kernel, paths)...)
+}
+
+func WDInstance(project, instance string, paths ...interface{}) string {
+	return WDProject(project, wdAppend("instances", instance, paths)...)
+}
+
+func WDOut(project string, paths ...interface{}) string {
+	return WDProject(project, wdAppend("out", paths)...)
+}
+
 func wdAppend(v ...interface{}) []interface{} {
 	var ret []interface{}
 